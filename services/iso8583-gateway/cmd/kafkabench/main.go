@@ -0,0 +1,103 @@
+// Command kafkabench compares the sync and async producer paths against the
+// brokers configured in the environment. It publishes the same load through
+// both and prints throughput and send latency for each.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"iso8583-gateway/infra/kafka"
+	"iso8583-gateway/internal/config"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func main() {
+	topic := flag.String("topic", "gateway.bench", "topic to publish to")
+	messages := flag.Int("messages", 20000, "messages per run")
+	concurrency := flag.Int("concurrency", 64, "concurrent senders, like concurrent inbound requests")
+	size := flag.Int("size", 512, "message size in bytes")
+	flag.Parse()
+
+	cfg, err := config.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+	payload := make([]byte, *size)
+	for _, mode := range []string{kafka.ProducerModeSync, kafka.ProducerModeAsync} {
+		kafkaCfg := *cfg.Kafka
+		kafkaCfg.ProducerMode = mode
+		kafkaCfg.TransactionalID = ""
+		p, err := kafka.InitKafka(&kafkaCfg)
+		if err != nil {
+			log.Fatalf("init %s producer: %v", mode, err)
+		}
+		result := run(p, *topic, payload, *messages, *concurrency)
+		if err := p.Close(); err != nil {
+			log.Printf("close %s producer: %v", mode, err)
+		}
+		fmt.Printf("%-5s %s\n", mode, result)
+	}
+}
+
+type result struct {
+	elapsed   time.Duration
+	sent      int
+	failed    int
+	latencies []time.Duration
+}
+
+func (r result) String() string {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	return fmt.Sprintf("%8.0f msg/s  sent=%d failed=%d  p50=%v p99=%v",
+		float64(r.sent)/r.elapsed.Seconds(), r.sent, r.failed, percentile(r.latencies, 0.50), percentile(r.latencies, 0.99))
+}
+
+func run(p sarama.SyncProducer, topic string, payload []byte, messages int, concurrency int) result {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	r := result{latencies: make([]time.Duration, 0, messages)}
+	jobs := make(chan int)
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sentAt := time.Now()
+				_, _, err := p.SendMessage(&sarama.ProducerMessage{
+					Topic: topic,
+					Key:   sarama.StringEncoder(fmt.Sprintf("%d", i)),
+					Value: sarama.ByteEncoder(payload),
+				})
+				latency := time.Since(sentAt)
+				mu.Lock()
+				if err != nil {
+					r.failed++
+				} else {
+					r.sent++
+					r.latencies = append(r.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < messages; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	return r
+}
+
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*q)]
+}
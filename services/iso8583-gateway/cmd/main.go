@@ -1,10 +1,23 @@
 package main
 
 import (
+	"crypto/cipher"
+	"fmt"
+	"iso8583-gateway/infra/file"
 	"iso8583-gateway/infra/kafka"
+	"iso8583-gateway/infra/nats"
+	"iso8583-gateway/internal/admin"
 	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/journal"
+	"iso8583-gateway/internal/profile"
+	"iso8583-gateway/internal/publisher"
+	"iso8583-gateway/internal/reversal"
+	"iso8583-gateway/internal/rules"
 	"iso8583-gateway/internal/server"
+	"iso8583-gateway/internal/validation"
+	"iso8583-gateway/pkg/contract"
 	"iso8583-gateway/pkg/logger"
+	"iso8583-gateway/pkg/tracing"
 	"log"
 	"os"
 	"os/signal"
@@ -14,21 +27,144 @@ import (
 )
 
 func main() {
-	cfg := config.Init()
-	err := logger.InitLogger(cfg.Logger.Level, cfg.Logger.Format)
+	cfg, err := config.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = logger.InitLogger(cfg.Logger.Level, cfg.Logger.Format)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer logger.Sync()
-	producer := kafka.InitKafka(cfg.Kafka)
+	err = tracing.InitTracer(cfg.Tracing.Exporter, cfg.Tracing.ServiceName, cfg.Tracing.SampleRatio)
+	if err != nil {
+		zap.L().Fatal("Failed to initialize tracer", zap.String("exporter", cfg.Tracing.Exporter), zap.Error(err))
+	}
+	defer tracing.Shutdown()
+	j, err := journal.Open(cfg.Journal)
+	if err != nil {
+		zap.L().Fatal("Failed to open journal", zap.Error(err))
+	}
+	defer closeJournal(j)
+	var reversalKey cipher.AEAD
+	if cfg.Journal.KeyFile != "" {
+		reversalKey, err = journal.LoadKey(cfg.Journal.KeyFile)
+		if err != nil {
+			zap.L().Fatal("Failed to load journal key", zap.Error(err))
+		}
+	} else {
+		zap.L().Warn("JOURNAL_KEY_FILE not set, raw frames will not be journaled and pending reversals are stored unencrypted")
+	}
+	reversalStore, err := reversal.NewFileStore(cfg.Application.ReversalStorePath, reversalKey)
+	if err != nil {
+		zap.L().Fatal("Failed to open reversal store", zap.Error(err))
+	}
+	if cfg.Journal.HashKeyFile == "" {
+		zap.L().Warn("JOURNAL_HASH_KEY_FILE not set, transactions cannot be searched by destination account")
+	}
+	engine, err := rules.Load(cfg.Rules)
+	if err != nil {
+		zap.L().Fatal("Failed to load rules", zap.Error(err))
+	}
+	validator, err := validation.Load(cfg.Validation)
+	if err != nil {
+		zap.L().Fatal("Failed to load validation specs", zap.Error(err))
+	}
+	profiles, err := profile.Load(cfg.Profile)
+	if err != nil {
+		zap.L().Fatal("Failed to load spec profiles", zap.Error(err))
+	}
+	listeners, err := cfg.Server.LoadListeners()
+	if err != nil {
+		zap.L().Fatal("Failed to load listeners", zap.Error(err))
+	}
+	serializer, err := contract.NewSerializer(cfg.Application.Serializer)
+	if err != nil {
+		zap.L().Fatal("Failed to initialize serializer", zap.Error(err))
+	}
+	pub, err := newPublisher(cfg)
+	if err != nil {
+		zap.L().Fatal("Failed to initialize publisher", zap.String("sink", cfg.Publisher.Sink), zap.Error(err))
+	}
+	defer closePublisher(pub)
+	var subscriber publisher.Subscriber
+	if cfg.Publisher.Sink == publisher.SinkKafka {
+		consumer, err := kafka.InitConsumer(cfg.Kafka)
+		if err != nil {
+			kafka.Close()
+			zap.L().Fatal("Failed to initialize kafka consumer", zap.Error(err))
+		}
+		subscriber = kafka.NewSubscriber(consumer)
+	} else {
+		zap.L().Warn("Publishing without Kafka, backend responses, timeout responses, automatic reversals and the shared session directory are disabled", zap.String("sink", cfg.Publisher.Sink))
+	}
 	defer kafka.Close()
-	srv := server.NewServer(cfg.Server.Host, cfg.Server.Port, cfg.Application, producer)
+	srv := server.NewServer(cfg.Application, pub, subscriber, reversalStore, j, engine, serializer, validator, profiles)
+	for _, listener := range listeners {
+		if err := srv.AddListener(listener); err != nil {
+			zap.L().Fatal("Failed to add listener", zap.Error(err))
+		}
+	}
 	go srv.Start()
+	var adminToken string
+	if cfg.Admin.TokenFile != "" {
+		adminToken, err = admin.LoadToken(cfg.Admin.TokenFile)
+		if err != nil {
+			zap.L().Fatal("Failed to load admin token", zap.Error(err))
+		}
+	} else {
+		zap.L().Warn("ADMIN_TOKEN_FILE not set, the journal and listener endpoints are disabled")
+	}
+	adminSrv := admin.NewServer(cfg.Admin.Host, cfg.Admin.Port)
+	adminSrv.Handle("GET /journal/transactions", admin.RequireToken(adminToken, admin.NewJournalSearchHandler(j)))
+	adminSrv.Handle("GET /listeners", admin.RequireToken(adminToken, admin.NewListenersHandler(srv)))
+	adminSrv.Handle("POST /listeners/{name}/start", admin.RequireToken(adminToken, admin.NewListenerStartHandler(srv)))
+	adminSrv.Handle("POST /listeners/{name}/stop", admin.RequireToken(adminToken, admin.NewListenerStopHandler(srv)))
+	go adminSrv.Start()
 
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 	<-shutdown
 	zap.L().Info("Server is shutting down...")
 	srv.Shutdown()
+	adminSrv.Shutdown()
 	zap.L().Info("Server stopped")
 }
+
+func closeJournal(j *journal.Journal) {
+	if err := j.Close(); err != nil {
+		zap.L().Error("Fail to close journal", zap.Error(err))
+	}
+}
+
+func newPublisher(cfg *config.Config) (publisher.Publisher, error) {
+	switch cfg.Publisher.Sink {
+	case publisher.SinkKafka:
+		producer, err := kafka.InitKafka(cfg.Kafka)
+		if err != nil {
+			return nil, err
+		}
+		return kafka.NewPublisher(producer), nil
+	case publisher.SinkNATS:
+		p, err := nats.NewPublisher(cfg.Publisher)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case publisher.SinkFile:
+		p, err := file.NewPublisher(cfg.Publisher.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case publisher.SinkMemory:
+		return publisher.NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unsupported PUBLISHER_SINK %q, expected kafka, nats, file or memory", cfg.Publisher.Sink)
+}
+
+func closePublisher(p publisher.Publisher) {
+	if err := p.Close(); err != nil {
+		zap.L().Error("Fail to close publisher", zap.Error(err))
+	}
+}
@@ -0,0 +1,33 @@
+// Command schemacheck verifies that every schema version in the contract
+// registry is fully compatible with the versions before it. Run it in CI
+// after adding a schema version.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"iso8583-gateway/pkg/contract"
+	"log"
+	"os"
+)
+
+func main() {
+	dir := flag.String("dir", "pkg/contract/registry", "registry directory")
+	flag.Parse()
+
+	registry := contract.NewRegistry(os.DirFS(*dir))
+	if err := registry.Check(); err != nil {
+		log.Fatalf("schema registry %s is not compatible:\n%v", *dir, err)
+	}
+	subjects, err := registry.Subjects()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, subject := range subjects {
+		latest, err := registry.Latest(subject)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s ok\n", latest.ID())
+	}
+}
@@ -0,0 +1,100 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iso8583-gateway/internal/publisher"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type record struct {
+	Topic       string            `json:"topic"`
+	Key         string            `json:"key,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Value       json.RawMessage   `json:"value,omitempty"`
+	ValueBase64 []byte            `json:"value_base64,omitempty"`
+	Offset      int64             `json:"offset"`
+	PublishedAt time.Time         `json:"published_at"`
+}
+
+// Publisher appends every message as one JSON line to a local file. JSON
+// values are written as is, anything else base64 encoded. The line number is
+// reported as the offset.
+type Publisher struct {
+	mu     sync.Mutex
+	file   *os.File
+	offset int64
+}
+
+func NewPublisher(path string) (*Publisher, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create publisher file directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open publisher file %s: %w", path, err)
+	}
+	lines, err := countLines(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read publisher file %s: %w", path, err)
+	}
+	return &Publisher{file: f, offset: lines}, nil
+}
+
+func (p *Publisher) Publish(msg *publisher.Message) (publisher.Receipt, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := record{
+		Topic:       msg.Topic,
+		Key:         msg.Key,
+		Offset:      p.offset,
+		PublishedAt: time.Now().UTC(),
+	}
+	if json.Valid(msg.Value) {
+		r.Value = msg.Value
+	} else {
+		r.ValueBase64 = msg.Value
+	}
+	if len(msg.Headers) > 0 {
+		r.Headers = make(map[string]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			r.Headers[h.Key] = h.Value
+		}
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return publisher.Receipt{}, err
+	}
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return publisher.Receipt{}, err
+	}
+	p.offset++
+	return publisher.Receipt{Offset: r.Offset}, nil
+}
+
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.file.Close()
+}
+
+func countLines(f *os.File) (int64, error) {
+	var lines int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// batchingProducer puts a SyncProducer face on an AsyncProducer. Callers still
+// block until their record is acknowledged, but records sent concurrently are
+// batched together, flushed after the configured linger, record count or byte
+// size, whichever comes first. The outcome of each record is delivered back to
+// its caller through the record's Metadata, so publish failures still reach
+// the dead letter and journal handling of the caller.
+type batchingProducer struct {
+	sarama.AsyncProducer
+	wg sync.WaitGroup
+
+	// mu keeps Close from closing the input while a record is enqueued.
+	mu     sync.RWMutex
+	closed bool
+}
+
+var errProducerClosed = errors.New("kafka producer is closed")
+
+func newBatchingProducer(p sarama.AsyncProducer) *batchingProducer {
+	bp := &batchingProducer{AsyncProducer: p}
+	bp.wg.Add(2)
+	go bp.processSuccesses()
+	go bp.processErrors()
+	return bp
+}
+
+func (p *batchingProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	done, err := p.enqueue(msg)
+	if err != nil {
+		return -1, -1, err
+	}
+	if err := <-done; err != nil {
+		return -1, -1, err
+	}
+	return msg.Partition, msg.Offset, nil
+}
+
+func (p *batchingProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	pending := make([]chan error, len(msgs))
+	var errs sarama.ProducerErrors
+	for i, msg := range msgs {
+		done, err := p.enqueue(msg)
+		if err != nil {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: err})
+			continue
+		}
+		pending[i] = done
+	}
+	for i, done := range pending {
+		if done == nil {
+			continue
+		}
+		if err := <-done; err != nil {
+			errs = append(errs, &sarama.ProducerError{Msg: msgs[i], Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *batchingProducer) enqueue(msg *sarama.ProducerMessage) (chan error, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, errProducerClosed
+	}
+	done := make(chan error, 1)
+	msg.Metadata = done
+	p.AsyncProducer.Input() <- msg
+	return done, nil
+}
+
+func (p *batchingProducer) processSuccesses() {
+	defer p.wg.Done()
+	for msg := range p.AsyncProducer.Successes() {
+		msg.Metadata.(chan error) <- nil
+	}
+}
+
+func (p *batchingProducer) processErrors() {
+	defer p.wg.Done()
+	for perr := range p.AsyncProducer.Errors() {
+		perr.Msg.Metadata.(chan error) <- perr.Err
+	}
+}
+
+// Close flushes buffered records and waits until every caller has its
+// outcome. Records sent after Close fail with errProducerClosed.
+func (p *batchingProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+	p.AsyncProducer.AsyncClose()
+	p.wg.Wait()
+	return nil
+}
@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"errors"
+	"iso8583-gateway/internal/publisher"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+func asyncConfig(t testing.TB) *sarama.Config {
+	t.Helper()
+	cfg := kafkaConfig()
+	cfg.ProducerMode = ProducerModeAsync
+	saramaCfg, err := newProducerConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saramaCfg
+}
+
+func TestBatchingProducerDeliversOutcomes(t *testing.T) {
+	mock := mocks.NewAsyncProducer(t, asyncConfig(t))
+	producer := newBatchingProducer(mock)
+	defer producer.Close()
+
+	failure := errors.New("message too large")
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(failure)
+
+	if _, _, err := producer.SendMessage(&sarama.ProducerMessage{Topic: "transfer.inbound.request"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := producer.SendMessage(&sarama.ProducerMessage{Topic: "transfer.inbound.request"}); !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+}
+
+func TestBatchingProducerSendAfterClose(t *testing.T) {
+	producer := newBatchingProducer(mocks.NewAsyncProducer(t, asyncConfig(t)))
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := producer.SendMessage(&sarama.ProducerMessage{Topic: "transfer.inbound.request"}); !errors.Is(err, errProducerClosed) {
+		t.Fatalf("err = %v, want %v", err, errProducerClosed)
+	}
+	err := producer.SendMessages([]*sarama.ProducerMessage{{Topic: "transfer.inbound.request"}})
+	var errs sarama.ProducerErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs[0].Err, errProducerClosed) {
+		t.Fatalf("err = %v, want %v", err, errProducerClosed)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The benchmarks compare the overhead of both paths under concurrent
+// publishers, like concurrent inbound requests. The mocks have no network
+// latency, so use cmd/kafkabench to measure batching against real brokers.
+
+func BenchmarkSyncProducer(b *testing.B) {
+	cfg := kafkaConfig()
+	saramaCfg, err := newProducerConfig(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mock := mocks.NewSyncProducer(b, saramaCfg)
+	for i := 0; i < b.N; i++ {
+		mock.ExpectSendMessageAndSucceed()
+	}
+	benchmarkPublisher(b, NewPublisher(mock))
+	mock.Close()
+}
+
+func BenchmarkAsyncProducer(b *testing.B) {
+	mock := mocks.NewAsyncProducer(b, asyncConfig(b))
+	for i := 0; i < b.N; i++ {
+		mock.ExpectInputAndSucceed()
+	}
+	producer := newBatchingProducer(mock)
+	benchmarkPublisher(b, NewPublisher(producer))
+	producer.Close()
+}
+
+func benchmarkPublisher(b *testing.B, pub *Publisher) {
+	msg := publisher.Message{
+		Topic:   "transfer.inbound.request",
+		Value:   make([]byte, 512),
+		Headers: []publisher.Header{{Key: "trace_id", Value: "trace"}},
+	}
+	b.SetParallelism(8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			msg := msg
+			if _, err := pub.Publish(&msg); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
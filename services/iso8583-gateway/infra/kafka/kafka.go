@@ -1,31 +1,159 @@
 package kafka
 
 import (
+	"errors"
+	"fmt"
 	"iso8583-gateway/internal/config"
 
 	"github.com/IBM/sarama"
 	"go.uber.org/zap"
 )
 
+const (
+	ProducerModeSync  = "sync"
+	ProducerModeAsync = "async"
+)
+
 var producer sarama.SyncProducer
+var consumer sarama.Consumer
 
-func InitKafka(cfg *config.KafkaConfig) sarama.SyncProducer {
-	saramaCfg := sarama.NewConfig()
+func InitKafka(cfg *config.KafkaConfig) (sarama.SyncProducer, error) {
+	saramaCfg, err := newProducerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ProducerMode == ProducerModeAsync {
+		asyncProducer, err := sarama.NewAsyncProducer(cfg.Brokers, saramaCfg)
+		if err != nil {
+			return nil, fmt.Errorf("create kafka producer for %v: %w", cfg.Brokers, err)
+		}
+		producer = newBatchingProducer(asyncProducer)
+		return producer, nil
+	}
+	syncProducer, err := sarama.NewSyncProducer(cfg.Brokers, saramaCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka producer for %v: %w", cfg.Brokers, err)
+	}
+	producer = syncProducer
+	if syncProducer.IsTransactional() {
+		producer = newTransactionalProducer(syncProducer)
+	}
+	return producer, nil
+}
+
+// newProducerConfig applies the producer mode, batching and delivery
+// guarantees of cfg on top of the shared settings.
+func newProducerConfig(cfg *config.KafkaConfig) (*sarama.Config, error) {
+	saramaCfg, err := newSaramaConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 	saramaCfg.Producer.RequiredAcks = sarama.WaitForAll
 	saramaCfg.Producer.Retry.Max = cfg.Retry
 	saramaCfg.Producer.Return.Successes = true
 	saramaCfg.Producer.Return.Errors = true
 	saramaCfg.Producer.Timeout = cfg.Timeout
+	saramaCfg.Producer.Partitioner = javaCompatiblePartitioner
+	saramaCfg.Producer.Compression = compression(cfg.Compression)
+	switch cfg.ProducerMode {
+	case "", ProducerModeSync:
+	case ProducerModeAsync:
+		if cfg.TransactionalID != "" {
+			return nil, errors.New("KAFKA_PRODUCER_MODE async can't be used with KAFKA_TRANSACTIONAL_ID")
+		}
+		saramaCfg.Producer.Flush.Frequency = cfg.BatchLinger
+		saramaCfg.Producer.Flush.Messages = cfg.BatchMaxMessages
+		saramaCfg.Producer.Flush.Bytes = cfg.BatchMaxBytes
+		if cfg.Compression == "" {
+			saramaCfg.Producer.Compression = sarama.CompressionLZ4
+		}
+	default:
+		return nil, fmt.Errorf("unsupported KAFKA_PRODUCER_MODE %q, expected sync or async", cfg.ProducerMode)
+	}
+	if cfg.Idempotent || cfg.TransactionalID != "" {
+		// Retries of a timed out send are deduplicated by the broker.
+		saramaCfg.Producer.Idempotent = true
+		saramaCfg.Net.MaxOpenRequests = 1
+		if cfg.Version == "" {
+			saramaCfg.Version = sarama.V2_5_0_0
+		}
+	}
+	saramaCfg.Producer.Transaction.ID = cfg.TransactionalID
+	if err := saramaCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kafka producer config: %w", err)
+	}
+	return saramaCfg, nil
+}
 
-	syncProducer, err := sarama.NewSyncProducer(cfg.Brokers, saramaCfg)
+func InitConsumer(cfg *config.KafkaConfig) (sarama.Consumer, error) {
+	saramaCfg, err := newSaramaConfig(cfg)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	producer = syncProducer
-	return producer
+	saramaCfg.Consumer.Return.Errors = true
+	if cfg.TransactionalID != "" {
+		saramaCfg.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
+	if err := saramaCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kafka consumer config: %w", err)
+	}
+
+	c, err := sarama.NewConsumer(cfg.Brokers, saramaCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka consumer for %v: %w", cfg.Brokers, err)
+	}
+	consumer = c
+	return consumer, nil
+}
+
+// newSaramaConfig holds the settings shared by producer and consumer:
+// client identity, protocol version and connection security.
+func newSaramaConfig(cfg *config.KafkaConfig) (*sarama.Config, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("KAFKA_BROKERS is empty")
+	}
+	saramaCfg := sarama.NewConfig()
+	if cfg.ClientID != "" {
+		saramaCfg.ClientID = cfg.ClientID
+	}
+	if cfg.Version != "" {
+		version, err := sarama.ParseKafkaVersion(cfg.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KAFKA_VERSION %q: %w", cfg.Version, err)
+		}
+		saramaCfg.Version = version
+	}
+	if _, ok := compressionCodecs[cfg.Compression]; !ok {
+		return nil, fmt.Errorf("unsupported KAFKA_COMPRESSION %q, expected none, gzip, snappy, lz4 or zstd", cfg.Compression)
+	}
+	if err := configureTLS(saramaCfg, cfg); err != nil {
+		return nil, err
+	}
+	if err := configureSASL(saramaCfg, cfg); err != nil {
+		return nil, err
+	}
+	return saramaCfg, nil
+}
+
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"":       sarama.CompressionNone,
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+func compression(name string) sarama.CompressionCodec {
+	return compressionCodecs[name]
 }
 
 func Close() {
+	if consumer != nil {
+		if err := consumer.Close(); err != nil {
+			zap.L().Error("Fail to close kafka consumer", zap.Error(err))
+		}
+	}
 	if producer != nil {
 		if err := producer.Close(); err != nil {
 			zap.L().Error("Fail to close kafka producer", zap.Error(err))
@@ -0,0 +1,314 @@
+package kafka
+
+import (
+	"errors"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/publisher"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// recordingProducer records the transaction calls, which the sarama mock
+// accepts without tracking.
+type recordingProducer struct {
+	*mocks.SyncProducer
+	calls []string
+}
+
+func (p *recordingProducer) BeginTxn() error {
+	p.calls = append(p.calls, "begin")
+	return p.SyncProducer.BeginTxn()
+}
+
+func (p *recordingProducer) CommitTxn() error {
+	p.calls = append(p.calls, "commit")
+	return p.SyncProducer.CommitTxn()
+}
+
+func (p *recordingProducer) AbortTxn() error {
+	p.calls = append(p.calls, "abort")
+	return p.SyncProducer.AbortTxn()
+}
+
+func kafkaConfig() *config.KafkaConfig {
+	return &config.KafkaConfig{
+		Brokers:          []string{"localhost:9092"},
+		ClientID:         "test",
+		Retry:            3,
+		Timeout:          5 * time.Second,
+		ProducerMode:     ProducerModeSync,
+		BatchMaxMessages: 500,
+		BatchMaxBytes:    1 << 20,
+	}
+}
+
+func TestIdempotentProducer(t *testing.T) {
+	cfg := kafkaConfig()
+	cfg.Idempotent = true
+	saramaCfg, err := newProducerConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saramaCfg.Producer.Idempotent || saramaCfg.Net.MaxOpenRequests != 1 {
+		t.Fatalf("idempotent = %v, max open requests = %d", saramaCfg.Producer.Idempotent, saramaCfg.Net.MaxOpenRequests)
+	}
+	if !saramaCfg.Version.IsAtLeast(sarama.V0_11_0_0) {
+		t.Fatalf("version %s doesn't support idempotence", saramaCfg.Version)
+	}
+
+	mock := mocks.NewSyncProducer(t, saramaCfg)
+	defer mock.Close()
+	if mock.IsTransactional() {
+		t.Fatal("idempotent producer is transactional")
+	}
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "transfer.inbound.request" || string(msg.Headers[0].Key) != "trace_id" {
+			return errors.New("unexpected record")
+		}
+		return nil
+	})
+	_, err = NewPublisher(mock).Publish(&publisher.Message{
+		Topic:   "transfer.inbound.request",
+		Key:     "trace",
+		Value:   []byte("{}"),
+		Headers: []publisher.Header{{Key: "trace_id", Value: "trace"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func transactionalConfig(t *testing.T) *sarama.Config {
+	t.Helper()
+	cfg := kafkaConfig()
+	cfg.TransactionalID = "gateway-1"
+	saramaCfg, err := newProducerConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saramaCfg
+}
+
+func TestTransactionalProducer(t *testing.T) {
+	saramaCfg := transactionalConfig(t)
+	if !saramaCfg.Producer.Idempotent || saramaCfg.Producer.Transaction.ID != "gateway-1" {
+		t.Fatalf("idempotent = %v, transaction ID = %q", saramaCfg.Producer.Idempotent, saramaCfg.Producer.Transaction.ID)
+	}
+
+	mock := &recordingProducer{SyncProducer: mocks.NewSyncProducer(t, saramaCfg)}
+	if !mock.IsTransactional() {
+		t.Fatal("producer isn't transactional")
+	}
+	producer := newTransactionalProducer(mock)
+	defer producer.Close()
+	pub := NewPublisher(producer)
+
+	mock.ExpectSendMessageAndSucceed()
+	if _, err := pub.Publish(&publisher.Message{Topic: "transfer.inbound.request", Value: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	assertCalls(t, mock.calls, "begin", "commit")
+	if mock.TxnStatus() != sarama.ProducerTxnFlagReady {
+		t.Fatalf("transaction status = %v after commit", mock.TxnStatus())
+	}
+}
+
+// A request and its journal record are committed in one transaction, or
+// aborted together.
+func TestTransactionalSideEffects(t *testing.T) {
+	mock := &recordingProducer{SyncProducer: mocks.NewSyncProducer(t, transactionalConfig(t))}
+	producer := newTransactionalProducer(mock)
+	defer producer.Close()
+	pub := NewPublisher(producer)
+	if !pub.Transactional() {
+		t.Fatal("publisher isn't transactional")
+	}
+	msgs := []*publisher.Message{
+		{Topic: "transfer.inbound.request", Value: []byte("{}")},
+		{Topic: "gateway.journal", Key: "trace-1", Value: []byte("{}")},
+	}
+
+	mock.ExpectSendMessageAndSucceed()
+	mock.ExpectSendMessageAndSucceed()
+	receipts, err := pub.PublishTransaction(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("got %d receipts, want 2", len(receipts))
+	}
+	assertCalls(t, mock.calls, "begin", "commit")
+
+	failure := errors.New("not enough replicas")
+	mock.calls = nil
+	mock.ExpectSendMessageAndSucceed()
+	mock.ExpectSendMessageAndFail(failure)
+	if _, err := pub.PublishTransaction(msgs); !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+	assertCalls(t, mock.calls, "begin", "abort")
+}
+
+// A failed send is aborted and the dead letter record that follows is
+// committed in a transaction of its own.
+func TestTransactionalDeadLetter(t *testing.T) {
+	mock := &recordingProducer{SyncProducer: mocks.NewSyncProducer(t, transactionalConfig(t))}
+	producer := newTransactionalProducer(mock)
+	defer producer.Close()
+	pub := NewPublisher(producer)
+
+	failure := errors.New("not enough replicas")
+	mock.ExpectSendMessageAndFail(failure)
+	mock.ExpectSendMessageAndSucceed()
+
+	if _, err := pub.Publish(&publisher.Message{Topic: "transfer.inbound.request", Value: []byte("{}")}); !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+	if _, err := pub.Publish(&publisher.Message{Topic: "transfer.inbound.dlq", Value: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	assertCalls(t, mock.calls, "begin", "abort", "begin", "commit")
+}
+
+// gatedProducer holds the first transaction open until release is closed, so
+// calls made meanwhile queue up for the next one.
+type gatedProducer struct {
+	*recordingProducer
+	started chan struct{}
+	release chan struct{}
+	sent    [][]string
+	once    sync.Once
+}
+
+func (p *gatedProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	p.once.Do(func() {
+		close(p.started)
+		<-p.release
+	})
+	topics := make([]string, len(msgs))
+	for i, msg := range msgs {
+		topics[i] = msg.Topic
+	}
+	p.sent = append(p.sent, topics)
+	return p.recordingProducer.SendMessages(msgs)
+}
+
+// Calls made while a transaction commits share the next transaction instead
+// of each waiting for a transaction of their own.
+func TestTransactionalGroupCommit(t *testing.T) {
+	mock := &gatedProducer{recordingProducer: &recordingProducer{SyncProducer: mocks.NewSyncProducer(t, transactionalConfig(t))}, started: make(chan struct{}), release: make(chan struct{})}
+	producer := newTransactionalProducer(mock)
+	defer producer.Close()
+	pub := NewPublisher(producer)
+	for range 4 {
+		mock.ExpectSendMessageAndSucceed()
+	}
+
+	var wg sync.WaitGroup
+	publish := func(topic string) {
+		defer wg.Done()
+		if _, err := pub.Publish(&publisher.Message{Topic: topic, Value: []byte("{}")}); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(1)
+	go publish("first")
+	<-mock.started
+	wg.Add(3)
+	for _, topic := range []string{"a", "b", "c"} {
+		go publish(topic)
+	}
+	// Let the three calls reach the producer while the first one commits.
+	time.Sleep(50 * time.Millisecond)
+	close(mock.release)
+	wg.Wait()
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalls(t, mock.calls, "begin", "commit", "begin", "commit")
+	if len(mock.sent) != 2 || len(mock.sent[1]) != 3 {
+		t.Fatalf("transactions sent %v, want [first] then the three others", mock.sent)
+	}
+}
+
+// failingProducer fails the records sent to one topic with the per-record
+// errors of a real producer.
+type failingProducer struct {
+	*recordingProducer
+	topic string
+	err   error
+}
+
+func (p *failingProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+	for _, msg := range msgs {
+		if msg.Topic == p.topic {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: p.err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return p.recordingProducer.SendMessages(msgs)
+}
+
+// A record that fails aborts the transaction it shares with other calls. The
+// other calls are retried without it, and only the failing call fails.
+func TestTransactionalRetriesOtherCalls(t *testing.T) {
+	failure := errors.New("record too large")
+	mock := &failingProducer{recordingProducer: &recordingProducer{SyncProducer: mocks.NewSyncProducer(t, transactionalConfig(t))}, topic: "bad", err: failure}
+	producer := newTransactionalProducer(mock)
+	defer producer.Close()
+	mock.ExpectSendMessageAndSucceed()
+
+	good := &txnCall{msgs: []*sarama.ProducerMessage{{Topic: "good", Value: sarama.StringEncoder("{}")}}, result: make(chan error, 1)}
+	bad := &txnCall{msgs: []*sarama.ProducerMessage{{Topic: "bad", Value: sarama.StringEncoder("{}")}}, result: make(chan error, 1)}
+	producer.commit([]*txnCall{good, bad})
+
+	if err := <-good.result; err != nil {
+		t.Errorf("good call failed: %v", err)
+	}
+	if err := <-bad.result; !errors.Is(err, failure) {
+		t.Errorf("bad call err = %v, want %v", err, failure)
+	}
+	assertCalls(t, mock.calls, "begin", "abort", "begin", "commit")
+}
+
+func TestTransactionalProducerClosed(t *testing.T) {
+	producer := newTransactionalProducer(mocks.NewSyncProducer(t, transactionalConfig(t)))
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if _, _, err := producer.SendMessage(&sarama.ProducerMessage{Topic: "transfer.inbound.request"}); !errors.Is(err, errProducerClosed) {
+		t.Fatalf("err = %v, want %v", err, errProducerClosed)
+	}
+}
+
+func TestAsyncProducerRejectsTransactions(t *testing.T) {
+	cfg := kafkaConfig()
+	cfg.ProducerMode = ProducerModeAsync
+	cfg.TransactionalID = "gateway-1"
+	if _, err := newProducerConfig(cfg); err == nil {
+		t.Fatal("async mode accepted a transactional ID")
+	}
+}
+
+func assertCalls(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("calls = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", got, want)
+		}
+	}
+}
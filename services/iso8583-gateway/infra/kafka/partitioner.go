@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"hash"
+
+	"github.com/IBM/sarama"
+)
+
+// javaCompatiblePartitioner places keyed records on the same partition the
+// Java client's default partitioner would, so a key chosen on either side of
+// the topic always maps to one partition.
+var javaCompatiblePartitioner = sarama.NewCustomPartitioner(
+	sarama.WithAbsFirst(),
+	sarama.WithCustomHashFunction(newMurmur2),
+)
+
+// PartitionForKey returns the partition a keyed record lands on when produced
+// by the Java client or by this gateway.
+func PartitionForKey(key string, numPartitions int32) int32 {
+	h := newMurmur2()
+	_, _ = h.Write([]byte(key))
+	return (int32(h.Sum32()) & 0x7fffffff) % numPartitions
+}
+
+// murmur2 is the hash Kafka's Java client uses for key partitioning
+// (org.apache.kafka.common.utils.Utils#murmur2).
+type murmur2 struct {
+	data []byte
+}
+
+func newMurmur2() hash.Hash32 {
+	return &murmur2{}
+}
+
+func (m *murmur2) Write(p []byte) (int, error) {
+	m.data = append(m.data, p...)
+	return len(p), nil
+}
+
+func (m *murmur2) Sum(b []byte) []byte {
+	s := m.Sum32()
+	return append(b, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+func (m *murmur2) Reset() {
+	m.data = m.data[:0]
+}
+
+func (m *murmur2) Size() int {
+	return 4
+}
+
+func (m *murmur2) BlockSize() int {
+	return 4
+}
+
+func (m *murmur2) Sum32() uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		mul  uint32 = 0x5bd1e995
+		r           = 24
+	)
+	data := m.data
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= mul
+		k ^= k >> r
+		k *= mul
+		h *= mul
+		h ^= k
+	}
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= mul
+	}
+	h ^= h >> 13
+	h *= mul
+	h ^= h >> 15
+	return h
+}
@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// murmur2Vectors are the expected hashes of Kafka's Java client
+// (org.apache.kafka.common.utils.UtilsTest#testMurmur2).
+var murmur2Vectors = []struct {
+	key  string
+	hash int32
+}{
+	{"21", -973932308},
+	{"foobar", -790332482},
+	{"a-little-bit-long-string", -985981536},
+	{"a-little-bit-longer-string", -1486304829},
+	{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+	{"abc", 479470107},
+}
+
+func TestMurmur2MatchesJavaClient(t *testing.T) {
+	for _, tt := range murmur2Vectors {
+		h := newMurmur2()
+		_, _ = h.Write([]byte(tt.key))
+		if got := int32(h.Sum32()); got != tt.hash {
+			t.Errorf("murmur2(%q) = %d, want %d", tt.key, got, tt.hash)
+		}
+	}
+}
+
+// TestPartitionForKey checks the partition against the Java default
+// partitioner, toPositive(murmur2(key)) % numPartitions, and that the
+// producer's partitioner agrees with it.
+func TestPartitionForKey(t *testing.T) {
+	for _, tt := range murmur2Vectors {
+		for _, numPartitions := range []int32{1, 3, 12} {
+			want := (tt.hash & 0x7fffffff) % numPartitions
+			if got := PartitionForKey(tt.key, numPartitions); got != want {
+				t.Errorf("PartitionForKey(%q, %d) = %d, want %d", tt.key, numPartitions, got, want)
+			}
+			partitioner := javaCompatiblePartitioner("requests")
+			got, err := partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(tt.key)}, numPartitions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("producer partition of %q over %d = %d, want %d", tt.key, numPartitions, got, want)
+			}
+		}
+	}
+}
+
+func TestSubscriberPartition(t *testing.T) {
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.SetTopicMetadata(map[string][]int32{"responses": {0, 1, 2}, "empty": {}})
+	subscriber := NewSubscriber(consumer)
+
+	got, err := subscriber.Partition("responses", "gateway-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := PartitionForKey("gateway-1", 3); got != want {
+		t.Errorf("Partition = %d, want %d", got, want)
+	}
+	if _, err := subscriber.Partition("empty", "gateway-1"); err == nil {
+		t.Error("Partition of a topic without partitions succeeded")
+	}
+}
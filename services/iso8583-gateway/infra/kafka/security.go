@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"os"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	SASLMechanismSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+func configureTLS(saramaCfg *sarama.Config, cfg *config.KafkaConfig) error {
+	if !cfg.TLSEnabled {
+		return nil
+	}
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSCAFile != "" {
+		ca, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return fmt.Errorf("read KAFKA_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("KAFKA_TLS_CA_FILE %s contains no PEM certificate", cfg.TLSCAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return errors.New("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("load kafka client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	saramaCfg.Net.TLS.Enable = true
+	saramaCfg.Net.TLS.Config = tlsCfg
+	return nil
+}
+
+func configureSASL(saramaCfg *sarama.Config, cfg *config.KafkaConfig) error {
+	if cfg.SASLMechanism == "" {
+		return nil
+	}
+	if cfg.SASLUsernameFile == "" || cfg.SASLPasswordFile == "" {
+		return errors.New("KAFKA_SASL_USERNAME_FILE and KAFKA_SASL_PASSWORD_FILE are required when KAFKA_SASL_MECHANISM is set")
+	}
+	username, err := readSecret(cfg.SASLUsernameFile)
+	if err != nil {
+		return fmt.Errorf("read KAFKA_SASL_USERNAME_FILE: %w", err)
+	}
+	password, err := readSecret(cfg.SASLPasswordFile)
+	if err != nil {
+		return fmt.Errorf("read KAFKA_SASL_PASSWORD_FILE: %w", err)
+	}
+	saramaCfg.Net.SASL.Enable = true
+	saramaCfg.Net.SASL.Handshake = true
+	saramaCfg.Net.SASL.User = username
+	saramaCfg.Net.SASL.Password = password
+	switch strings.ToUpper(cfg.SASLMechanism) {
+	case SASLMechanismPlain:
+		saramaCfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		if !cfg.TLSEnabled {
+			zap.L().Warn("SASL PLAIN without TLS sends the Kafka credentials in clear text, set KAFKA_TLS_ENABLED=true")
+		}
+	case SASLMechanismSCRAMSHA256:
+		saramaCfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		saramaCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha256Generator}
+		}
+	case SASLMechanismSCRAMSHA512:
+		saramaCfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		saramaCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha512Generator}
+		}
+	default:
+		return fmt.Errorf("unsupported KAFKA_SASL_MECHANISM %q, expected %s, %s or %s", cfg.SASLMechanism, SASLMechanismPlain, SASLMechanismSCRAMSHA256, SASLMechanismSCRAMSHA512)
+	}
+	return nil
+}
+
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
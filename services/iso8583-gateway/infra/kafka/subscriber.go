@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"iso8583-gateway/internal/publisher"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+// Subscriber reads partitions through the consumer returned by InitConsumer.
+type Subscriber struct {
+	consumer sarama.Consumer
+}
+
+func NewSubscriber(consumer sarama.Consumer) *Subscriber {
+	return &Subscriber{consumer: consumer}
+}
+
+func (s *Subscriber) Partitions(topic string) ([]int32, error) {
+	return s.consumer.Partitions(topic)
+}
+
+func (s *Subscriber) Partition(topic string, key string) (int32, error) {
+	partitions, err := s.consumer.Partitions(topic)
+	if err != nil {
+		return -1, err
+	}
+	if len(partitions) == 0 {
+		return -1, fmt.Errorf("topic %s has no partitions", topic)
+	}
+	return PartitionForKey(key, int32(len(partitions))), nil
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, topic string, partitions []int32, fromOldest bool, handle func(*publisher.Record)) error {
+	offset := sarama.OffsetNewest
+	if fromOldest {
+		offset = sarama.OffsetOldest
+	}
+	var pcs []sarama.PartitionConsumer
+	for _, partition := range partitions {
+		pc, err := s.consumer.ConsumePartition(topic, partition, offset)
+		if err != nil {
+			for _, started := range pcs {
+				closePartition(topic, started)
+			}
+			return err
+		}
+		pcs = append(pcs, pc)
+	}
+	var wg sync.WaitGroup
+	for _, pc := range pcs {
+		wg.Add(1)
+		go func(pc sarama.PartitionConsumer) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					closePartition(topic, pc)
+					return
+				case msg, ok := <-pc.Messages():
+					if !ok {
+						return
+					}
+					handle(newRecord(msg))
+				case err, ok := <-pc.Errors():
+					if !ok {
+						return
+					}
+					zap.L().Error("Fail to consume kafka message", zap.String("topic", err.Topic), zap.Int32("partition", err.Partition), zap.Error(err.Err))
+				}
+			}
+		}(pc)
+	}
+	wg.Wait()
+	return nil
+}
+
+func newRecord(msg *sarama.ConsumerMessage) *publisher.Record {
+	record := &publisher.Record{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   make([]publisher.Header, 0, len(msg.Headers)),
+	}
+	for _, h := range msg.Headers {
+		if h != nil {
+			record.Headers = append(record.Headers, publisher.Header{Key: string(h.Key), Value: string(h.Value)})
+		}
+	}
+	return record
+}
+
+// closePartition stops pc and waits for its messages and errors to be
+// drained.
+func closePartition(topic string, pc sarama.PartitionConsumer) {
+	if err := pc.Close(); err != nil {
+		zap.L().Error("Fail to close partition consumer", zap.String("topic", topic), zap.Error(err))
+	}
+}
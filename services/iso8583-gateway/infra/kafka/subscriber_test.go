@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"context"
+	"iso8583-gateway/internal/publisher"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+func TestSubscriberDeliversAndDrains(t *testing.T) {
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.SetTopicMetadata(map[string][]int32{"responses": {0, 1}})
+	first := consumer.ExpectConsumePartition("responses", 0, sarama.OffsetNewest)
+	// Closing on cancel must drain the partition consumer, not abandon it.
+	consumer.ExpectConsumePartition("responses", 1, sarama.OffsetNewest).ExpectMessagesDrainedOnClose()
+
+	first.YieldMessage(&sarama.ConsumerMessage{
+		Topic:   "responses",
+		Key:     []byte("gw-a"),
+		Value:   []byte("{}"),
+		Headers: []*sarama.RecordHeader{{Key: []byte("trace_id"), Value: []byte("trace-1")}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	records := make(chan *publisher.Record, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := NewSubscriber(consumer).Subscribe(ctx, "responses", []int32{0, 1}, false, func(r *publisher.Record) {
+			records <- r
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	record := <-records
+	if record.Header("trace_id") != "trace-1" || string(record.Key) != "gw-a" || record.Partition != 0 {
+		t.Errorf("got record %+v", record)
+	}
+	cancel()
+	wg.Wait()
+	if err := consumer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// maxTransactionRecords caps the records committed in one transaction.
+const maxTransactionRecords = 500
+
+// transactionalProducer commits records in Kafka transactions. The records of
+// one SendMessages call are committed together or not at all, so a request
+// and the records that go with it, such as its journal record, are never seen
+// apart by read_committed consumers.
+//
+// Calls are not given a transaction each: the calls made while a transaction
+// commits share the next one, so concurrent callers wait for at most one
+// commit instead of queueing behind each other. An aborted transaction takes
+// every record in it down, so the calls whose records didn't fail are retried
+// in a new transaction without the failed ones.
+type transactionalProducer struct {
+	sarama.SyncProducer
+	calls chan *txnCall
+	done  chan struct{}
+
+	// mu keeps Close from closing calls while a call is handed over.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// txnCall is one SendMessages call waiting for the transaction its records
+// are committed in.
+type txnCall struct {
+	msgs   []*sarama.ProducerMessage
+	result chan error
+}
+
+func newTransactionalProducer(p sarama.SyncProducer) *transactionalProducer {
+	tp := &transactionalProducer{SyncProducer: p, calls: make(chan *txnCall), done: make(chan struct{})}
+	go tp.run()
+	return tp
+}
+
+func (p *transactionalProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if err := p.SendMessages([]*sarama.ProducerMessage{msg}); err != nil {
+		return -1, -1, err
+	}
+	return msg.Partition, msg.Offset, nil
+}
+
+func (p *transactionalProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	call := &txnCall{msgs: msgs, result: make(chan error, 1)}
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return errProducerClosed
+	}
+	p.calls <- call
+	p.mu.RUnlock()
+	return <-call.result
+}
+
+// run commits the waiting calls, one transaction at a time, until Close.
+func (p *transactionalProducer) run() {
+	defer close(p.done)
+	for call := range p.calls {
+		calls := []*txnCall{call}
+		records := len(call.msgs)
+	gather:
+		for records < maxTransactionRecords {
+			select {
+			case next, ok := <-p.calls:
+				if !ok {
+					break gather
+				}
+				calls = append(calls, next)
+				records += len(next.msgs)
+			default:
+				break gather
+			}
+		}
+		p.commit(calls)
+	}
+}
+
+// commit sends the records of calls in one transaction and reports the
+// outcome to each call.
+func (p *transactionalProducer) commit(calls []*txnCall) {
+	// Records are sent as copies, so a retried record goes out without the
+	// state sarama kept from the aborted attempt.
+	var records, originals []*sarama.ProducerMessage
+	owners := make(map[*sarama.ProducerMessage]*txnCall)
+	for _, call := range calls {
+		for _, msg := range call.msgs {
+			record := &sarama.ProducerMessage{Topic: msg.Topic, Key: msg.Key, Value: msg.Value, Headers: msg.Headers, Metadata: msg.Metadata, Timestamp: msg.Timestamp}
+			records = append(records, record)
+			originals = append(originals, msg)
+			owners[record] = call
+		}
+	}
+	err := p.send(records)
+	if err == nil {
+		for i, record := range records {
+			originals[i].Partition = record.Partition
+			originals[i].Offset = record.Offset
+		}
+		for _, call := range calls {
+			call.result <- nil
+		}
+		return
+	}
+	var failed sarama.ProducerErrors
+	if !errors.As(err, &failed) {
+		for _, call := range calls {
+			call.result <- err
+		}
+		return
+	}
+	// Each call that had a record fail gets the error of that record.
+	callErrs := make(map[*txnCall]error)
+	for _, perr := range failed {
+		if call, ok := owners[perr.Msg]; ok && callErrs[call] == nil {
+			callErrs[call] = perr.Err
+		}
+	}
+	var retry []*txnCall
+	for _, call := range calls {
+		switch {
+		case len(callErrs) == 0:
+			call.result <- err
+		case callErrs[call] != nil:
+			call.result <- callErrs[call]
+		default:
+			retry = append(retry, call)
+		}
+	}
+	if len(retry) > 0 {
+		p.commit(retry)
+	}
+}
+
+// send commits records in one transaction, or aborts it.
+func (p *transactionalProducer) send(records []*sarama.ProducerMessage) error {
+	if err := p.SyncProducer.BeginTxn(); err != nil {
+		return fmt.Errorf("begin kafka transaction: %w", err)
+	}
+	if err := p.SyncProducer.SendMessages(records); err != nil {
+		return p.abort(err)
+	}
+	if err := p.SyncProducer.CommitTxn(); err != nil {
+		return p.abort(fmt.Errorf("commit kafka transaction: %w", err))
+	}
+	return nil
+}
+
+func (p *transactionalProducer) abort(cause error) error {
+	if p.SyncProducer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0 {
+		return fmt.Errorf("fatal kafka transaction error: %w", cause)
+	}
+	if err := p.SyncProducer.AbortTxn(); err != nil {
+		return fmt.Errorf("abort kafka transaction after %v: %w", cause, err)
+	}
+	return cause
+}
+
+// Close commits the calls already handed over and closes the producer. Calls
+// made after Close fail with errProducerClosed.
+func (p *transactionalProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.calls)
+	p.mu.Unlock()
+	<-p.done
+	return p.SyncProducer.Close()
+}
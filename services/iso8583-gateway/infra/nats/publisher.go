@@ -0,0 +1,53 @@
+package nats
+
+import (
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/publisher"
+
+	natsio "github.com/nats-io/nats.go"
+)
+
+// keyHeader carries the message key, which NATS has no field for.
+const keyHeader = "Gateway-Key"
+
+// Publisher publishes to NATS JetStream, using the topic as the subject. A
+// stream must capture the subjects, so every message is acknowledged once
+// stored; the stream sequence is reported as the offset.
+type Publisher struct {
+	conn *natsio.Conn
+	js   natsio.JetStreamContext
+}
+
+func NewPublisher(cfg *config.PublisherConfig) (*Publisher, error) {
+	conn, err := natsio.Connect(cfg.NATSURL, natsio.Name(cfg.NATSName))
+	if err != nil {
+		return nil, fmt.Errorf("connect to nats %s: %w", cfg.NATSURL, err)
+	}
+	js, err := conn.JetStream(natsio.MaxWait(cfg.Timeout))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create jetstream context: %w", err)
+	}
+	return &Publisher{conn: conn, js: js}, nil
+}
+
+func (p *Publisher) Publish(msg *publisher.Message) (publisher.Receipt, error) {
+	m := natsio.NewMsg(msg.Topic)
+	m.Data = msg.Value
+	if msg.Key != "" {
+		m.Header.Set(keyHeader, msg.Key)
+	}
+	for _, h := range msg.Headers {
+		m.Header.Add(h.Key, h.Value)
+	}
+	ack, err := p.js.PublishMsg(m)
+	if err != nil {
+		return publisher.Receipt{}, err
+	}
+	return publisher.Receipt{Offset: int64(ack.Sequence)}, nil
+}
+
+func (p *Publisher) Close() error {
+	return p.conn.Drain()
+}
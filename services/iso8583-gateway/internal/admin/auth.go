@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// LoadToken reads the bearer token that guards the administrative endpoints.
+func LoadToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read admin token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("admin token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// RequireToken serves next only to requests with the header
+// "Authorization: Bearer <token>". Without a token every request is refused,
+// so the endpoint is closed until one is configured.
+func RequireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeJSON(w, http.StatusForbidden, &errorResponse{Error: "admin endpoint disabled, ADMIN_TOKEN_FILE is not set"})
+			return
+		}
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="iso8583-gateway"`)
+			writeJSON(w, http.StatusUnauthorized, &errorResponse{Error: "missing or invalid admin token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
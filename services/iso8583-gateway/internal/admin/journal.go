@@ -0,0 +1,171 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"iso8583-gateway/internal/journal"
+	"iso8583-gateway/pkg/element"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type messageView struct {
+	MTI    string         `json:"mti"`
+	Fields map[int]string `json:"fields"`
+	At     time.Time      `json:"at"`
+}
+
+type transactionView struct {
+	TraceID    string       `json:"trace_id"`
+	Status     string       `json:"status"`
+	SessionID  string       `json:"session_id"`
+	RemoteAddr string       `json:"remote_addr"`
+	Topic      string       `json:"topic,omitempty"`
+	Partition  int32        `json:"partition"`
+	Offset     int64        `json:"offset"`
+	Request    *messageView `json:"request"`
+	Response   *messageView `json:"response,omitempty"`
+	LatencyMs  *int64       `json:"latency_ms,omitempty"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+type searchResponse struct {
+	Transactions  []*transactionView `json:"transactions"`
+	NextPageToken string             `json:"next_page_token,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewJournalSearchHandler serves GET requests searching the transaction
+// journal. Raw frames are never returned.
+//
+// Query parameters: rrn (F37), stan (F11), f7_from and f7_to (MMDDhhmmss,
+// in the year closest to now),
+// acquirer (F32), destination_account (F103, hashed before the search) or
+// destination_account_hash (its hex HMAC-SHA256),
+// response_code (F39), processing_code (F3 or a prefix of it),
+// received_from and received_to (RFC 3339), page_size and page_token.
+func NewJournalSearchHandler(j *journal.Journal) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := &journal.Filter{
+			RRN:                    q.Get("rrn"),
+			STAN:                   q.Get("stan"),
+			AcquirerID:             q.Get("acquirer"),
+			DestinationAccountHash: q.Get("destination_account_hash"),
+			ResponseCode:           q.Get("response_code"),
+			ProcessingCode:         q.Get("processing_code"),
+		}
+		if account := q.Get("destination_account"); account != "" {
+			filter.DestinationAccountHash = j.HashAccount(account)
+			if filter.DestinationAccountHash == "" {
+				writeJSON(w, http.StatusBadRequest, &errorResponse{Error: "destination account search needs JOURNAL_HASH_KEY_FILE"})
+				return
+			}
+		}
+		var err error
+		if filter.TransmissionFrom, err = parseTransmissionTime(q.Get("f7_from")); err != nil {
+			writeJSON(w, http.StatusBadRequest, &errorResponse{Error: "invalid f7_from: " + err.Error()})
+			return
+		}
+		if filter.TransmissionTo, err = parseTransmissionTime(q.Get("f7_to")); err != nil {
+			writeJSON(w, http.StatusBadRequest, &errorResponse{Error: "invalid f7_to: " + err.Error()})
+			return
+		}
+		if filter.ReceivedFrom, err = parseTime(q.Get("received_from")); err != nil {
+			writeJSON(w, http.StatusBadRequest, &errorResponse{Error: "invalid received_from: " + err.Error()})
+			return
+		}
+		if filter.ReceivedTo, err = parseTime(q.Get("received_to")); err != nil {
+			writeJSON(w, http.StatusBadRequest, &errorResponse{Error: "invalid received_to: " + err.Error()})
+			return
+		}
+		pageSize := defaultPageSize
+		if v := q.Get("page_size"); v != "" {
+			pageSize, err = strconv.Atoi(v)
+			if err != nil || pageSize < 1 || pageSize > maxPageSize {
+				writeJSON(w, http.StatusBadRequest, &errorResponse{Error: "page_size must be between 1 and " + strconv.Itoa(maxPageSize)})
+				return
+			}
+		}
+		transactions, next, err := j.Search(filter, q.Get("page_token"), pageSize)
+		if errors.Is(err, journal.ErrInvalidPageToken) {
+			writeJSON(w, http.StatusBadRequest, &errorResponse{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			zap.L().Error("Failed to search journal", zap.Error(err))
+			writeJSON(w, http.StatusInternalServerError, &errorResponse{Error: "journal search failed"})
+			return
+		}
+		resp := &searchResponse{
+			Transactions:  make([]*transactionView, 0, len(transactions)),
+			NextPageToken: next,
+		}
+		for _, t := range transactions {
+			resp.Transactions = append(resp.Transactions, newTransactionView(t))
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+func newTransactionView(t *journal.Transaction) *transactionView {
+	view := &transactionView{
+		TraceID:    t.TraceID,
+		Status:     t.Status,
+		SessionID:  t.SessionID,
+		RemoteAddr: t.RemoteAddr,
+		Topic:      t.Topic,
+		Partition:  t.Partition,
+		Offset:     t.Offset,
+		Request:    newMessageView(t.Request),
+		Response:   newMessageView(t.Response),
+		UpdatedAt:  t.UpdatedAt,
+	}
+	if t.Request != nil && t.Response != nil {
+		latency := t.Response.At.Sub(t.Request.At).Milliseconds()
+		view.LatencyMs = &latency
+	}
+	return view
+}
+
+func newMessageView(m *journal.Message) *messageView {
+	if m == nil {
+		return nil
+	}
+	return &messageView{MTI: m.MTI, Fields: m.Fields, At: m.At}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseTransmissionTime reads an F7 bound in the year closest to now, so a
+// range such as 1231000000 to 0101235959 spans the new year.
+func parseTransmissionTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return element.ParseTransmissionTime(value, time.Now())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		zap.L().Error("Failed to write admin response", zap.Error(err))
+	}
+}
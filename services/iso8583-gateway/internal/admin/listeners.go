@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"iso8583-gateway/internal/server"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+type listenerView struct {
+	Name      string  `json:"name"`
+	Address   string  `json:"address"`
+	Profile   string  `json:"profile"`
+	Framing   string  `json:"framing"`
+	TLS       bool    `json:"tls"`
+	Running   bool    `json:"running"`
+	RateLimit float64 `json:"rate_limit,omitempty"`
+}
+
+// NewListenersHandler serves GET requests listing the listeners and whether
+// each one is running.
+func NewListenersHandler(srv *server.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listeners := srv.Listeners()
+		views := make([]*listenerView, 0, len(listeners))
+		for _, listener := range listeners {
+			views = append(views, newListenerView(listener))
+		}
+		writeJSON(w, http.StatusOK, views)
+	})
+}
+
+// NewListenerStartHandler serves POST requests starting the listener named
+// by the {name} path value.
+func NewListenerStartHandler(srv *server.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listener, ok := srv.Listener(r.PathValue("name"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, &errorResponse{Error: "unknown listener"})
+			return
+		}
+		if err := listener.Start(); err != nil {
+			zap.L().Error("Failed to start listener", zap.String("listener", listener.Name()), zap.Error(err))
+			writeJSON(w, http.StatusConflict, &errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, newListenerView(listener))
+	})
+}
+
+// NewListenerStopHandler serves POST requests stopping the listener named by
+// the {name} path value. Its sessions are closed; other listeners are not
+// affected.
+func NewListenerStopHandler(srv *server.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listener, ok := srv.Listener(r.PathValue("name"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, &errorResponse{Error: "unknown listener"})
+			return
+		}
+		listener.Stop()
+		writeJSON(w, http.StatusOK, newListenerView(listener))
+	})
+}
+
+func newListenerView(listener *server.Listener) *listenerView {
+	cfg := listener.Config()
+	return &listenerView{
+		Name:      cfg.Name,
+		Address:   cfg.Address(),
+		Profile:   cfg.Profile,
+		Framing:   cfg.Framing,
+		TLS:       cfg.TLS != nil,
+		Running:   listener.Running(),
+		RateLimit: cfg.RateLimit,
+	}
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iso8583-gateway/pkg/metrics"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Server is the HTTP plane for operators: metrics and administrative endpoints.
+type Server struct {
+	httpServer *http.Server
+	mux        *http.ServeMux
+}
+
+func NewServer(host string, port string) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	return &Server{
+		httpServer: &http.Server{
+			Addr:              fmt.Sprintf("%s:%s", host, port),
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		mux: mux,
+	}
+}
+
+// Handle registers an additional endpoint on the admin server.
+func (server *Server) Handle(pattern string, handler http.Handler) {
+	server.mux.Handle(pattern, handler)
+}
+
+func (server *Server) Start() {
+	zap.L().Info("Starting admin server", zap.String("address", server.httpServer.Addr))
+	if err := server.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		zap.L().Fatal("Failed to start admin server", zap.Error(err))
+	}
+}
+
+func (server *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.httpServer.Shutdown(ctx); err != nil {
+		zap.L().Error("Failed to shut down admin server", zap.Error(err))
+	}
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"iso8583-gateway/pkg/util"
 	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -15,13 +18,33 @@ import (
 type Config struct {
 	Logger      *LoggerConfig
 	Server      *ServerConfig
+	Profile     *ProfileConfig
+	Admin       *AdminConfig
+	Publisher   *PublisherConfig
 	Kafka       *KafkaConfig
+	Journal     *JournalConfig
+	Rules       *RulesConfig
+	Tracing     *TracingConfig
+	Validation  *ValidationConfig
 	Application *ApplicationConfig
 }
 
 type ServerConfig struct {
+	Host          string
+	Port          string
+	Profile       string
+	ListenersFile string
+}
+
+type ProfileConfig struct {
+	File string
+}
+
+type AdminConfig struct {
 	Host string
 	Port string
+	// TokenFile holds the bearer token of the journal and listener endpoints.
+	TokenFile string
 }
 
 type LoggerConfig struct {
@@ -29,18 +52,116 @@ type LoggerConfig struct {
 	Format string
 }
 
+type PublisherConfig struct {
+	Sink     string
+	NATSURL  string
+	NATSName string
+	Timeout  time.Duration
+	FilePath string
+}
+
 type KafkaConfig struct {
-	Brokers []string
-	Retry   int
-	Timeout time.Duration
+	Brokers          []string
+	Retry            int
+	Timeout          time.Duration
+	ClientID         string
+	Version          string
+	Compression      string
+	TLSEnabled       bool
+	TLSCAFile        string
+	TLSCertFile      string
+	TLSKeyFile       string
+	SASLMechanism    string
+	SASLUsernameFile string
+	SASLPasswordFile string
+	Idempotent       bool
+	TransactionalID  string
+	ProducerMode     string
+	BatchLinger      time.Duration
+	BatchMaxMessages int
+	BatchMaxBytes    int
+}
+
+type JournalConfig struct {
+	Dir         string
+	Retention   time.Duration
+	KeyFile     string
+	HashKeyFile string
+}
+
+const (
+	UnroutableDeadLetter = "dead_letter"
+	UnroutableReject     = "reject"
+)
+
+const (
+	ResponseRoutingPartition = "partition"
+	ResponseRoutingShared    = "shared"
+)
+
+// Route sends inbound messages to Topic. MTI and Institution (F100) must match
+// exactly and ProcessingCode is a prefix of F3; an empty criterion matches
+// anything.
+type Route struct {
+	Name           string `json:"name"`
+	MTI            string `json:"mti,omitempty"`
+	ProcessingCode string `json:"processing_code,omitempty"`
+	Institution    string `json:"institution,omitempty"`
+	Topic          string `json:"topic"`
+}
+
+func (r Route) Matches(mti string, processingCode string, institution string) bool {
+	return (r.MTI == "" || r.MTI == mti) &&
+		strings.HasPrefix(processingCode, r.ProcessingCode) &&
+		(r.Institution == "" || r.Institution == institution)
+}
+
+type RulesConfig struct {
+	File           string
+	ReloadInterval time.Duration
+	DryRun         bool
+}
+
+type ValidationConfig struct {
+	Enabled bool
+	File    string
+	Content bool
+}
+
+type TracingConfig struct {
+	Exporter    string
+	ServiceName string
+	SampleRatio float64
 }
 
 type ApplicationConfig struct {
-	InboundRequestTopic string
-	ServiceID           string
+	InboundRequestTopic   string
+	InboundResponseTopic  string
+	SessionDirectoryTopic string
+	ResponseRouting       string
+	DefaultSLATimeout     time.Duration
+	LatencySLA            time.Duration
+	SLATimeouts           map[string]time.Duration
+	CorrelationRetention  time.Duration
+	ReversalTopic         string
+	AdviceTopic           string
+	DedupeWindow          time.Duration
+	DeadLetterTopic       string
+	JournalTopic          string
+	EnvelopeRaw           bool
+	Serializer            string
+	CloudEvents           bool
+	CloudEventsTypePrefix string
+	Routes                []Route
+	UnroutableAction      string
+	ReversalRetryInterval time.Duration
+	ReversalStorePath     string
+	ServiceID             string
 }
 
-func Init() *Config {
+// Init reads the configuration from the environment. It fails on settings
+// that don't parse rather than silently using their default.
+func Init() (*Config, error) {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
@@ -51,25 +172,137 @@ func Init() *Config {
 	} else {
 		serviceID = id.String()
 	}
-	return &Config{
+	env := &envReader{}
+	cfg := &Config{
 		Logger: &LoggerConfig{
 			Level:  getEnv("LOG_LEVEL", "info"),
 			Format: getEnv("LOG_FORMAT", "json"),
 		},
 		Server: &ServerConfig{
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
-			Port: getEnv("SERVER_PORT", "11111"),
+			Host:          getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:          getEnv("SERVER_PORT", "11111"),
+			Profile:       getEnv("SERVER_PROFILE", "napas"),
+			ListenersFile: getEnv("LISTENERS_FILE", ""),
+		},
+		Profile: &ProfileConfig{
+			File: getEnv("PROFILES_FILE", ""),
+		},
+		Admin: &AdminConfig{
+			Host:      getEnv("ADMIN_HOST", "127.0.0.1"),
+			Port:      getEnv("ADMIN_PORT", "8080"),
+			TokenFile: getEnv("ADMIN_TOKEN_FILE", ""),
+		},
+		Publisher: &PublisherConfig{
+			Sink:     getEnv("PUBLISHER_SINK", "kafka"),
+			NATSURL:  getEnv("NATS_URL", "nats://localhost:4222"),
+			NATSName: getEnv("NATS_CLIENT_NAME", "iso8583-gateway"),
+			Timeout:  env.duration("NATS_TIMEOUT", 5*time.Second),
+			FilePath: getEnv("PUBLISHER_FILE_PATH", "data/published.jsonl"),
 		},
 		Kafka: &KafkaConfig{
-			Brokers: getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}, ","),
-			Retry:   getEnvAsInt("KAFKA_RETRY", 3),
-			Timeout: getEnvAsDuration("KAFKA_TIMEOUT", 5*time.Second),
+			Brokers:          getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}, ","),
+			Retry:            env.int("KAFKA_RETRY", 3),
+			Timeout:          env.duration("KAFKA_TIMEOUT", 5*time.Second),
+			ClientID:         getEnv("KAFKA_CLIENT_ID", "iso8583-gateway"),
+			Version:          getEnv("KAFKA_VERSION", ""),
+			Compression:      getEnv("KAFKA_COMPRESSION", ""),
+			TLSEnabled:       env.bool("KAFKA_TLS_ENABLED", false),
+			TLSCAFile:        getEnv("KAFKA_TLS_CA_FILE", ""),
+			TLSCertFile:      getEnv("KAFKA_TLS_CERT_FILE", ""),
+			TLSKeyFile:       getEnv("KAFKA_TLS_KEY_FILE", ""),
+			SASLMechanism:    getEnv("KAFKA_SASL_MECHANISM", ""),
+			SASLUsernameFile: getEnv("KAFKA_SASL_USERNAME_FILE", ""),
+			SASLPasswordFile: getEnv("KAFKA_SASL_PASSWORD_FILE", ""),
+			Idempotent:       env.bool("KAFKA_IDEMPOTENT", true),
+			TransactionalID:  getEnv("KAFKA_TRANSACTIONAL_ID", ""),
+			ProducerMode:     getEnv("KAFKA_PRODUCER_MODE", "sync"),
+			BatchLinger:      env.duration("KAFKA_BATCH_LINGER", 5*time.Millisecond),
+			BatchMaxMessages: env.int("KAFKA_BATCH_MAX_MESSAGES", 500),
+			BatchMaxBytes:    env.int("KAFKA_BATCH_MAX_BYTES", 1<<20),
+		},
+		Journal: &JournalConfig{
+			Dir:         getEnv("JOURNAL_DIR", "data/journal"),
+			Retention:   env.duration("JOURNAL_RETENTION", 90*24*time.Hour),
+			KeyFile:     getEnv("JOURNAL_KEY_FILE", ""),
+			HashKeyFile: getEnv("JOURNAL_HASH_KEY_FILE", ""),
+		},
+		Rules: &RulesConfig{
+			File:           getEnv("RULES_FILE", ""),
+			ReloadInterval: env.positiveDuration("RULES_RELOAD_INTERVAL", 5*time.Second),
+			DryRun:         env.bool("RULES_DRY_RUN", false),
+		},
+		Validation: &ValidationConfig{
+			Enabled: env.bool("VALIDATION_ENABLED", true),
+			File:    getEnv("VALIDATION_FILE", ""),
+			Content: env.bool("VALIDATION_CONTENT", true),
+		},
+		Tracing: &TracingConfig{
+			Exporter:    getEnv("OTEL_TRACES_EXPORTER", "none"),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "iso8583-gateway"),
+			SampleRatio: env.float("TRACING_SAMPLE_RATIO", 1.0),
 		},
 		Application: &ApplicationConfig{
-			InboundRequestTopic: getEnv("APP_INBOUND_REQUEST_TOPIC", "transfer.inbound.request"),
-			ServiceID:           serviceID,
+			InboundRequestTopic:   getEnv("APP_INBOUND_REQUEST_TOPIC", "transfer.inbound.request"),
+			InboundResponseTopic:  getEnv("APP_INBOUND_RESPONSE_TOPIC", "transfer.inbound.response"),
+			SessionDirectoryTopic: getEnv("APP_SESSION_DIRECTORY_TOPIC", "gateway.session.directory"),
+			ResponseRouting:       env.oneOf("APP_RESPONSE_ROUTING", ResponseRoutingPartition, ResponseRoutingPartition, ResponseRoutingShared),
+			DefaultSLATimeout:     env.duration("APP_SLA_DEFAULT_TIMEOUT", 30*time.Second),
+			LatencySLA:            env.duration("APP_LATENCY_SLA", time.Second),
+			SLATimeouts:           env.durationMap("APP_SLA_TIMEOUTS", map[string]time.Duration{"0200": 30 * time.Second}),
+			CorrelationRetention:  env.duration("APP_CORRELATION_RETENTION", 5*time.Minute),
+			ReversalTopic:         getEnv("APP_REVERSAL_TOPIC", "transfer.reversal.request"),
+			AdviceTopic:           getEnv("APP_ADVICE_TOPIC", "transfer.advice.request"),
+			DedupeWindow:          env.duration("APP_DEDUPE_WINDOW", 10*time.Minute),
+			DeadLetterTopic:       getEnv("APP_DEAD_LETTER_TOPIC", "transfer.inbound.dlq"),
+			JournalTopic:          getEnv("APP_JOURNAL_TOPIC", ""),
+			EnvelopeRaw:           env.bool("APP_ENVELOPE_RAW", false),
+			Serializer:            getEnv("APP_SERIALIZER", "json"),
+			CloudEvents:           env.bool("APP_CLOUDEVENTS", false),
+			CloudEventsTypePrefix: getEnv("APP_CLOUDEVENTS_TYPE_PREFIX", "iso8583.gateway"),
+			Routes:                env.routes("APP_ROUTES"),
+			UnroutableAction:      env.oneOf("APP_UNROUTABLE_ACTION", UnroutableDeadLetter, UnroutableDeadLetter, UnroutableReject),
+			ReversalRetryInterval: env.duration("APP_REVERSAL_RETRY_INTERVAL", 30*time.Second),
+			ReversalStorePath:     getEnv("APP_REVERSAL_STORE_PATH", "data/reversals.json"),
+			ServiceID:             serviceID,
 		},
 	}
+	if err := errors.Join(env.errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Institutions returns the institutions the routes match on.
+func (c *ApplicationConfig) Institutions() []string {
+	return routeInstitutions(c.Routes)
+}
+
+func routeInstitutions(routes []Route) []string {
+	var institutions []string
+	for _, route := range routes {
+		if route.Institution != "" {
+			institutions = append(institutions, route.Institution)
+		}
+	}
+	return institutions
+}
+
+// SLATimeout returns how long a request with the given MTI may wait for the backend.
+func (cfg *ApplicationConfig) SLATimeout(mti string) time.Duration {
+	if timeout, ok := cfg.SLATimeouts[mti]; ok {
+		return timeout
+	}
+	return cfg.DefaultSLATimeout
+}
+
+// MatchRoute returns the first configured route matching the message.
+func (cfg *ApplicationConfig) MatchRoute(mti string, processingCode string, institution string) (Route, bool) {
+	for _, route := range cfg.Routes {
+		if route.Matches(mti, processingCode, institution) {
+			return route, true
+		}
+	}
+	return Route{}, false
 }
 
 func getEnv(key, defaultValue string) string {
@@ -79,22 +312,78 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
+// envReader reads typed settings and collects those that don't parse, so a
+// typo such as KAFKA_TLS_ENABLED=yes fails startup instead of quietly
+// selecting the default.
+type envReader struct {
+	errs []error
+}
+
+func (env *envReader) invalid(key string, value string, err error) {
+	env.errs = append(env.errs, fmt.Errorf("invalid %s=%q: %w", key, value, err))
+}
+
+func (env *envReader) int(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
-	return defaultValue
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		env.invalid(key, value, err)
+		return defaultValue
+	}
+	return intValue
 }
 
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
-		}
+func (env *envReader) float(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
-	return defaultValue
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		env.invalid(key, value, err)
+		return defaultValue
+	}
+	return floatValue
+}
+
+func (env *envReader) bool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		env.invalid(key, value, errors.New("expected true or false"))
+		return defaultValue
+	}
+	return boolValue
+}
+
+func (env *envReader) duration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		env.invalid(key, value, err)
+		return defaultValue
+	}
+	return duration
+}
+
+// positiveDuration reads a duration that must be greater than zero, such as
+// a ticker interval.
+func (env *envReader) positiveDuration(key string, defaultValue time.Duration) time.Duration {
+	duration := env.duration(key, defaultValue)
+	if duration <= 0 {
+		env.invalid(key, os.Getenv(key), errors.New("must be greater than zero"))
+		return defaultValue
+	}
+	return duration
 }
 
 func getEnvAsSlice(key string, defaultValue []string, sep string) []string {
@@ -103,3 +392,68 @@ func getEnvAsSlice(key string, defaultValue []string, sep string) []string {
 	}
 	return defaultValue
 }
+
+// oneOf reads a setting that must be one of allowed.
+func (env *envReader) oneOf(key string, defaultValue string, allowed ...string) string {
+	value := getEnv(key, defaultValue)
+	if !slices.Contains(allowed, value) {
+		env.invalid(key, value, fmt.Errorf("expected one of %s", strings.Join(allowed, ", ")))
+		return defaultValue
+	}
+	return value
+}
+
+// durationMap parses values such as "0200=30s,0800=10s".
+func (env *envReader) durationMap(key string, defaultValue map[string]time.Duration) map[string]time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	result := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			env.invalid(key, pair, errors.New("expected MTI=duration"))
+			continue
+		}
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			env.invalid(key, pair, err)
+			continue
+		}
+		result[k] = duration
+	}
+	return result
+}
+
+// routes parses an ordered list of routes such as
+// "inquiry=0200:43:*:transfer.inquiry.request,transfer=0200:91::transfer.inbound.request",
+// each one name=MTI:processing code prefix:F100:topic with * or empty for any.
+func (env *envReader) routes(key string) []Route {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	var routes []Route
+	for _, entry := range strings.Split(value, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		parts := strings.Split(spec, ":")
+		if !ok || name == "" || len(parts) != 4 || parts[3] == "" {
+			env.invalid(key, entry, errors.New("expected name=MTI:processing code:F100:topic"))
+			continue
+		}
+		for i := range parts[:3] {
+			if parts[i] == "*" {
+				parts[i] = ""
+			}
+		}
+		routes = append(routes, Route{
+			Name:           name,
+			MTI:            parts[0],
+			ProcessingCode: parts[1],
+			Institution:    parts[2],
+			Topic:          parts[3],
+		})
+	}
+	return routes
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitRejectsInvalidValues(t *testing.T) {
+	t.Setenv("KAFKA_TLS_ENABLED", "yes")
+	t.Setenv("KAFKA_RETRY", "three")
+	t.Setenv("APP_SLA_TIMEOUTS", "0200=30s,0800")
+	t.Setenv("APP_UNROUTABLE_ACTION", "drop")
+	t.Setenv("APP_RESPONSE_ROUTING", "partitioned")
+	t.Setenv("RULES_RELOAD_INTERVAL", "0s")
+
+	_, err := Init()
+	if err == nil {
+		t.Fatal("Init accepted invalid settings")
+	}
+	for _, key := range []string{"KAFKA_TLS_ENABLED", "KAFKA_RETRY", "APP_SLA_TIMEOUTS", "APP_UNROUTABLE_ACTION", "APP_RESPONSE_ROUTING", "RULES_RELOAD_INTERVAL"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q doesn't name %s", err, key)
+		}
+	}
+}
+
+func TestInitReadsValidValues(t *testing.T) {
+	t.Setenv("KAFKA_TLS_ENABLED", "true")
+	t.Setenv("KAFKA_RETRY", "5")
+	t.Setenv("APP_SLA_TIMEOUTS", "0200=30s,0800=10s")
+
+	cfg, err := Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Kafka.TLSEnabled || cfg.Kafka.Retry != 5 {
+		t.Errorf("Kafka = %+v", cfg.Kafka)
+	}
+	if got := cfg.Application.SLATimeouts["0800"]; got != 10*time.Second {
+		t.Errorf("SLA timeout for 0800 = %s, want 10s", got)
+	}
+}
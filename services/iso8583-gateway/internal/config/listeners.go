@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	FramingASCII4  = "ascii4"
+	FramingBinary2 = "binary2"
+)
+
+// ListenerConfig is one port the gateway accepts partner connections on.
+type ListenerConfig struct {
+	Name    string `json:"name"`
+	Host    string `json:"host"`
+	Port    string `json:"port"`
+	Profile string `json:"profile"`
+	// Framing is the length header of every frame: ascii4, four ASCII
+	// digits, or binary2, two bytes big-endian.
+	Framing string       `json:"framing"`
+	TLS     *ListenerTLS `json:"tls,omitempty"`
+	// AllowedPeers are the addresses and CIDR blocks connections are accepted
+	// from. Empty allows any peer.
+	AllowedPeers []string `json:"allowed_peers,omitempty"`
+	// MaxSessionsPerIP caps the sessions one address holds on this listener,
+	// and MaxSessionsPerInstitution the sessions of this gateway instance an
+	// institution (F32) sends through. Zero is unlimited.
+	MaxSessionsPerIP          int `json:"max_sessions_per_ip,omitempty"`
+	MaxSessionsPerInstitution int `json:"max_sessions_per_institution,omitempty"`
+	// Acquirers bind the sessions of a peer to the acquirer ID it must send in
+	// F32. With BindAcquirer, other sessions are bound to the F32 of their
+	// first message.
+	Acquirers    []PeerAcquirer `json:"acquirers,omitempty"`
+	BindAcquirer bool           `json:"bind_acquirer,omitempty"`
+	// Routes are matched before APP_ROUTES for the messages read on this
+	// listener.
+	Routes []Route `json:"routes,omitempty"`
+	// RateLimit caps the messages per second read on this listener, across
+	// its sessions. Zero is unlimited.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	RateBurst int     `json:"rate_burst,omitempty"`
+	// Stopped listeners are not started with the gateway, only from the admin
+	// server.
+	Stopped bool `json:"stopped,omitempty"`
+}
+
+type ListenerTLS struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ClientCAFile, when set, requires clients to present a certificate
+	// signed by one of its CAs.
+	ClientCAFile string `json:"client_ca_file,omitempty"`
+}
+
+type PeerAcquirer struct {
+	Peer     string `json:"peer"`
+	Acquirer string `json:"acquirer"`
+}
+
+func (cfg *ListenerConfig) Address() string {
+	return fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
+}
+
+// Institutions returns the acquirers bound to the listener's peers and the
+// institutions its routes match on.
+func (cfg *ListenerConfig) Institutions() []string {
+	institutions := routeInstitutions(cfg.Routes)
+	for _, acquirer := range cfg.Acquirers {
+		institutions = append(institutions, acquirer.Acquirer)
+	}
+	return institutions
+}
+
+type listenersFile struct {
+	Listeners []*ListenerConfig `json:"listeners"`
+}
+
+// LoadListeners reads the listeners file. Without one, the gateway has a
+// single listener, default, on SERVER_HOST and SERVER_PORT.
+func (cfg *ServerConfig) LoadListeners() ([]*ListenerConfig, error) {
+	if cfg.ListenersFile == "" {
+		return []*ListenerConfig{{
+			Name:    "default",
+			Host:    cfg.Host,
+			Port:    cfg.Port,
+			Profile: cfg.Profile,
+			Framing: FramingASCII4,
+		}}, nil
+	}
+	data, err := os.ReadFile(cfg.ListenersFile)
+	if err != nil {
+		return nil, fmt.Errorf("read listeners file: %w", err)
+	}
+	var f listenersFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse listeners file %s: %w", cfg.ListenersFile, err)
+	}
+	if len(f.Listeners) == 0 {
+		return nil, fmt.Errorf("listeners file %s has no listeners", cfg.ListenersFile)
+	}
+	names := make(map[string]bool, len(f.Listeners))
+	for _, listener := range f.Listeners {
+		if listener.Name == "" {
+			return nil, errors.New("listener name is required")
+		}
+		if names[listener.Name] {
+			return nil, fmt.Errorf("duplicate listener name %q", listener.Name)
+		}
+		names[listener.Name] = true
+		if listener.Port == "" {
+			return nil, fmt.Errorf("listener %q: port is required", listener.Name)
+		}
+		if listener.Host == "" {
+			listener.Host = cfg.Host
+		}
+		if listener.Profile == "" {
+			listener.Profile = cfg.Profile
+		}
+		switch listener.Framing {
+		case "":
+			listener.Framing = FramingASCII4
+		case FramingASCII4, FramingBinary2:
+		default:
+			return nil, fmt.Errorf("listener %q: unknown framing %q, expected ascii4 or binary2", listener.Name, listener.Framing)
+		}
+		if listener.TLS != nil && (listener.TLS.CertFile == "" || listener.TLS.KeyFile == "") {
+			return nil, fmt.Errorf("listener %q: tls needs cert_file and key_file", listener.Name)
+		}
+		if listener.MaxSessionsPerIP < 0 || listener.MaxSessionsPerInstitution < 0 {
+			return nil, fmt.Errorf("listener %q: session limits cannot be negative", listener.Name)
+		}
+		for _, acquirer := range listener.Acquirers {
+			if acquirer.Peer == "" || acquirer.Acquirer == "" {
+				return nil, fmt.Errorf("listener %q: acquirers need a peer and an acquirer", listener.Name)
+			}
+		}
+		for _, route := range listener.Routes {
+			if route.Name == "" || route.Topic == "" {
+				return nil, fmt.Errorf("listener %q: routes need a name and a topic", listener.Name)
+			}
+		}
+	}
+	return f.Listeners, nil
+}
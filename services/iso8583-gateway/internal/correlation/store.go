@@ -0,0 +1,241 @@
+package correlation
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/pkg/element"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound          = errors.New("no request waiting for this response")
+	ErrDuplicateRequest  = errors.New("request already waiting for a response")
+	ErrDuplicateResponse = errors.New("request already answered")
+	ErrLateResponse      = errors.New("response arrived after the request timed out")
+)
+
+type State int
+
+const (
+	StatePending State = iota
+	StateCompleted
+	StateExpired
+)
+
+// Entry is a request that was forwarded to the backend, with the session it
+// came from and the time by which it must be answered.
+type Entry struct {
+	TraceID    string
+	Key        string
+	SessionID  string
+	Request    *domain.ISO8583Message
+	ReceivedAt time.Time
+	Timeout    time.Duration
+	Deadline   time.Time
+	state      State
+	finishedAt time.Time
+	index      int
+}
+
+func NewEntry(traceID string, sessionID string, request *domain.ISO8583Message, timeout time.Duration) *Entry {
+	now := time.Now()
+	return &Entry{
+		TraceID:    traceID,
+		Key:        Key(request),
+		SessionID:  sessionID,
+		Request:    request,
+		ReceivedAt: now,
+		Timeout:    timeout,
+		Deadline:   now.Add(timeout),
+	}
+}
+
+// Key identifies a transaction by STAN (F11), transmission date & time (F7)
+// and acquiring institution (F32), which the backend echoes in its response.
+func Key(msg *domain.ISO8583Message) string {
+	return key(msg.Fields[11], msg.Fields[7], msg.Fields[32])
+}
+
+// OriginalKey is the Key of the transaction that F90 refers to.
+func OriginalKey(original *element.OriginalDataElements) string {
+	return key(original.STAN, original.TransmissionDateTime, original.AcquirerID)
+}
+
+func key(stan string, transmissionDateTime string, acquirerID string) string {
+	// F90 carries the acquirer zero padded, F32 doesn't.
+	return stan + "|" + transmissionDateTime + "|" + strings.TrimLeft(acquirerID, "0")
+}
+
+// Store is the in-memory table of requests waiting for a backend response.
+// Answered and expired entries are kept for the retention period so duplicate
+// and late responses can be told apart from unknown ones.
+type Store struct {
+	mu        sync.Mutex
+	byTrace   map[string]*Entry
+	byKey     map[string]*Entry
+	pending   deadlineQueue
+	retention time.Duration
+}
+
+func NewStore(retention time.Duration) *Store {
+	return &Store{
+		byTrace:   make(map[string]*Entry),
+		byKey:     make(map[string]*Entry),
+		retention: retention,
+	}
+}
+
+func (s *Store) Register(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.byTrace[e.TraceID]; ok && existing.state == StatePending {
+		return ErrDuplicateRequest
+	}
+	if existing, ok := s.byKey[e.Key]; ok && existing.state == StatePending {
+		return ErrDuplicateRequest
+	}
+	s.byTrace[e.TraceID] = e
+	s.byKey[e.Key] = e
+	heap.Push(&s.pending, e)
+	return nil
+}
+
+// Match completes the request a response belongs to, looked up by trace ID
+// and then by STAN+F7+F32.
+func (s *Store) Match(traceID string, response *domain.ISO8583Message) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.byTrace[traceID]
+	if !ok {
+		e, ok = s.byKey[Key(response)]
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	switch e.state {
+	case StateCompleted:
+		return e, ErrDuplicateResponse
+	case StateExpired:
+		return e, ErrLateResponse
+	}
+	s.finish(e, StateCompleted)
+	return e, nil
+}
+
+// Remove forgets a pending request that never reached the backend, so it
+// does not time out and a retry with the same key can be registered.
+func (s *Store) Remove(traceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.byTrace[traceID]
+	if !ok || e.state != StatePending {
+		return
+	}
+	heap.Remove(&s.pending, e.index)
+	delete(s.byTrace, traceID)
+	if s.byKey[e.Key] == e {
+		delete(s.byKey, e.Key)
+	}
+}
+
+// Lookup returns the request with the given Key and its current state.
+func (s *Store) Lookup(key string) (*Entry, State, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.byKey[key]
+	if !ok {
+		return nil, StatePending, false
+	}
+	return e, e.state, true
+}
+
+// Run expires overdue requests, calling onExpire for each, until ctx is done.
+func (s *Store) Run(ctx context.Context, onExpire func(*Entry)) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, e := range s.expire(now) {
+				onExpire(e)
+			}
+			if now.Sub(lastPurge) >= time.Second {
+				s.purge(now)
+				lastPurge = now
+			}
+		}
+	}
+}
+
+func (s *Store) expire(now time.Time) []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []*Entry
+	for s.pending.Len() > 0 && !s.pending[0].Deadline.After(now) {
+		e := s.pending[0]
+		s.finish(e, StateExpired)
+		expired = append(expired, e)
+	}
+	return expired
+}
+
+func (s *Store) purge(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for traceID, e := range s.byTrace {
+		if s.purgeable(e, now) {
+			delete(s.byTrace, traceID)
+		}
+	}
+	for key, e := range s.byKey {
+		if s.purgeable(e, now) {
+			delete(s.byKey, key)
+		}
+	}
+}
+
+func (s *Store) purgeable(e *Entry, now time.Time) bool {
+	return e.state != StatePending && now.Sub(e.finishedAt) >= s.retention
+}
+
+func (s *Store) finish(e *Entry, state State) {
+	e.state = state
+	e.finishedAt = time.Now()
+	if e.index >= 0 {
+		heap.Remove(&s.pending, e.index)
+	}
+}
+
+// deadlineQueue is a min-heap of pending entries ordered by expiry.
+type deadlineQueue []*Entry
+
+func (q deadlineQueue) Len() int           { return len(q) }
+func (q deadlineQueue) Less(i, j int) bool { return q[i].Deadline.Before(q[j].Deadline) }
+func (q deadlineQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *deadlineQueue) Push(x any) {
+	e := x.(*Entry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *deadlineQueue) Pop() any {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*q = old[:n-1]
+	return e
+}
@@ -0,0 +1,124 @@
+package correlation
+
+import (
+	"context"
+	"errors"
+	"iso8583-gateway/internal/domain"
+	"testing"
+	"time"
+)
+
+func request(traceID string, stan string) *domain.ISO8583Message {
+	return domain.NewISO8583Message("0200", map[int]string{7: "1019093015", 11: stan, 32: "970436", 63: traceID})
+}
+
+func response(stan string) *domain.ISO8583Message {
+	return domain.NewISO8583Message("0210", map[int]string{7: "1019093015", 11: stan, 32: "970436", 39: "00"})
+}
+
+func register(t *testing.T, s *Store, traceID string, stan string, timeout time.Duration) *Entry {
+	t.Helper()
+	e := NewEntry(traceID, "session-1", request(traceID, stan), timeout)
+	if err := s.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestMatch(t *testing.T) {
+	s := NewStore(time.Minute)
+	register(t, s, "trace-1", "000001", time.Minute)
+	register(t, s, "trace-2", "000002", time.Minute)
+
+	if e, err := s.Match("trace-1", response("000001")); err != nil || e.TraceID != "trace-1" {
+		t.Errorf("Match by trace ID = %v, %v, want trace-1", e, err)
+	}
+	// A backend that drops the trace ID is matched on STAN+F7+F32.
+	if e, err := s.Match("", response("000002")); err != nil || e.TraceID != "trace-2" {
+		t.Errorf("Match by key = %v, %v, want trace-2", e, err)
+	}
+	if _, err := s.Match("trace-3", response("000003")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Match of an unknown request = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestDuplicateRequest(t *testing.T) {
+	s := NewStore(time.Minute)
+	register(t, s, "trace-1", "000001", time.Minute)
+	for _, e := range []*Entry{
+		NewEntry("trace-1", "session-1", request("trace-1", "000002"), time.Minute),
+		NewEntry("trace-2", "session-1", request("trace-2", "000001"), time.Minute),
+	} {
+		if err := s.Register(e); !errors.Is(err, ErrDuplicateRequest) {
+			t.Errorf("Register(%s, %s) = %v, want %v", e.TraceID, e.Key, err, ErrDuplicateRequest)
+		}
+	}
+}
+
+func TestDuplicateResponse(t *testing.T) {
+	s := NewStore(time.Minute)
+	register(t, s, "trace-1", "000001", time.Minute)
+	if _, err := s.Match("trace-1", response("000001")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Match("trace-1", response("000001")); !errors.Is(err, ErrDuplicateResponse) {
+		t.Errorf("second Match = %v, want %v", err, ErrDuplicateResponse)
+	}
+	if _, state, _ := s.Lookup(Key(request("trace-1", "000001"))); state != StateCompleted {
+		t.Errorf("state = %v, want completed", state)
+	}
+}
+
+func TestTimeoutAndLateResponse(t *testing.T) {
+	s := NewStore(time.Minute)
+	register(t, s, "trace-1", "000001", 50*time.Millisecond)
+	register(t, s, "trace-2", "000002", time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expired := make(chan *Entry, 2)
+	go s.Run(ctx, func(e *Entry) { expired <- e })
+	select {
+	case e := <-expired:
+		if e.TraceID != "trace-1" {
+			t.Fatalf("expired %s, want trace-1", e.TraceID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request did not time out")
+	}
+
+	if _, err := s.Match("trace-1", response("000001")); !errors.Is(err, ErrLateResponse) {
+		t.Errorf("Match after timeout = %v, want %v", err, ErrLateResponse)
+	}
+	if _, err := s.Match("trace-2", response("000002")); err != nil {
+		t.Errorf("Match of the request still pending = %v", err)
+	}
+}
+
+func TestRetentionPurge(t *testing.T) {
+	s := NewStore(time.Minute)
+	register(t, s, "trace-1", "000001", time.Minute)
+	if _, err := s.Match("trace-1", response("000001")); err != nil {
+		t.Fatal(err)
+	}
+	s.purge(time.Now().Add(2 * time.Minute))
+	if _, err := s.Match("trace-1", response("000001")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Match after retention = %v, want %v", err, ErrNotFound)
+	}
+}
+
+// TestRemove checks the cleanup after a publish failure: the request never
+// times out, a response finds nothing and a retry can be registered.
+func TestRemove(t *testing.T) {
+	s := NewStore(time.Minute)
+	register(t, s, "trace-1", "000001", time.Millisecond)
+	s.Remove("trace-1")
+
+	if expired := s.expire(time.Now().Add(time.Minute)); len(expired) != 0 {
+		t.Errorf("removed request timed out")
+	}
+	if _, err := s.Match("trace-1", response("000001")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Match after Remove = %v, want %v", err, ErrNotFound)
+	}
+	register(t, s, "trace-1", "000001", time.Minute)
+}
@@ -0,0 +1,85 @@
+package dedupe
+
+import (
+	"context"
+	"iso8583-gateway/internal/domain"
+	"sync"
+	"time"
+)
+
+// Record is a request seen within the dedupe window and, once it has been
+// answered, the response the peer received.
+type Record struct {
+	TraceID  string
+	SeenAt   time.Time
+	Response *domain.ISO8583Message
+}
+
+// Store remembers requests for a time window so retransmissions (0201 repeats
+// or identical 0200s) are not forwarded to the backend again.
+type Store struct {
+	mu      sync.Mutex
+	window  time.Duration
+	records map[string]*Record
+}
+
+func NewStore(window time.Duration) *Store {
+	return &Store{
+		window:  window,
+		records: make(map[string]*Record),
+	}
+}
+
+// Key identifies a transmission by acquirer (F32), STAN (F11), transmission
+// date & time (F7) and retrieval reference number (F37), which are the same
+// on every copy of a request and are echoed in its response.
+func Key(msg *domain.ISO8583Message) string {
+	return msg.Fields[32] + "|" + msg.Fields[11] + "|" + msg.Fields[7] + "|" + msg.Fields[37]
+}
+
+// Seen records the request under key and returns the earlier record if the
+// key was already seen within the window.
+func (s *Store) Seen(key string, traceID string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if r, ok := s.records[key]; ok && now.Sub(r.SeenAt) < s.window {
+		return *r, true
+	}
+	s.records[key] = &Record{TraceID: traceID, SeenAt: now}
+	return Record{}, false
+}
+
+// SetResponse caches the response sent for the request under key, so it can
+// be replayed to a retransmission.
+func (s *Store) SetResponse(key string, response *domain.ISO8583Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[key]; ok {
+		r.Response = response
+	}
+}
+
+// Run drops records older than the window until ctx is done.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.purge(now)
+		}
+	}
+}
+
+func (s *Store) purge(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, r := range s.records {
+		if now.Sub(r.SeenAt) >= s.window {
+			delete(s.records, key)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package dedupe
+
+import (
+	"iso8583-gateway/internal/domain"
+	"testing"
+	"time"
+)
+
+func transfer(mti string, traceID string) *domain.ISO8583Message {
+	return domain.NewISO8583Message(mti, map[int]string{7: "1019093015", 11: "000123", 32: "970436", 37: "629209000123", 63: traceID})
+}
+
+func TestKey(t *testing.T) {
+	// A repeat (0201) and a resend with a new trace ID are the same transmission.
+	first := Key(transfer("0200", "trace-1"))
+	for _, copy := range []*domain.ISO8583Message{transfer("0201", "trace-1"), transfer("0200", "trace-2")} {
+		if got := Key(copy); got != first {
+			t.Errorf("Key(%s %s) = %q, want %q", copy.MTI, copy.Fields[63], got, first)
+		}
+	}
+	other := transfer("0200", "trace-3")
+	other.Fields[11] = "000124"
+	if Key(other) == first {
+		t.Errorf("requests with different STANs share key %q", first)
+	}
+}
+
+func TestSeen(t *testing.T) {
+	s := NewStore(time.Minute)
+	key := Key(transfer("0200", "trace-1"))
+	if _, seen := s.Seen(key, "trace-1"); seen {
+		t.Fatal("first transmission reported as seen")
+	}
+	record, seen := s.Seen(key, "trace-2")
+	if !seen || record.TraceID != "trace-1" || record.Response != nil {
+		t.Fatalf("in-flight copy = %+v, %v, want trace-1 without a response", record, seen)
+	}
+
+	response := domain.NewResponse(transfer("0200", "trace-1"), "00")
+	s.SetResponse(key, response)
+	if record, _ := s.Seen(key, "trace-3"); record.Response != response {
+		t.Errorf("answered copy replays %v, want the cached response", record.Response)
+	}
+}
+
+func TestWindowExpiry(t *testing.T) {
+	s := NewStore(50 * time.Millisecond)
+	key := Key(transfer("0200", "trace-1"))
+	s.Seen(key, "trace-1")
+	time.Sleep(60 * time.Millisecond)
+	if _, seen := s.Seen(key, "trace-2"); seen {
+		t.Errorf("copy after the window reported as seen")
+	}
+
+	s.purge(time.Now().Add(time.Second))
+	if len(s.records) != 0 {
+		t.Errorf("got %d records after purge, want 0", len(s.records))
+	}
+	// SetResponse for a purged key must not bring it back.
+	s.SetResponse(key, domain.NewResponse(transfer("0200", "trace-2"), "00"))
+	if len(s.records) != 0 {
+		t.Errorf("SetResponse recorded a purged key")
+	}
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"iso8583-gateway/pkg/contract"
+	"time"
+)
+
+// NewEnvelope wraps msg in the envelope it is published in.
+func NewEnvelope(msg *ISO8583Message, traceID string, gatewayID string, sessionID string, remoteAddr string, includeRaw bool) *contract.Envelope {
+	receivedAt := msg.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	envelope := &contract.Envelope{
+		SchemaVersion: contract.EnvelopeSchemaVersion,
+		MTI:           msg.MTI,
+		Fields:        msg.Fields,
+		NamedFields:   contract.NamedFields(msg.Fields),
+		TraceID:       traceID,
+		ReceivedAt:    receivedAt.UTC(),
+		GatewayID:     gatewayID,
+		SessionID:     sessionID,
+		RemoteAddr:    remoteAddr,
+		Profile:       msg.Profile,
+		Institution: contract.EnvelopeInstitution{
+			AcquirerID:  msg.Fields[32],
+			ForwarderID: msg.Fields[33],
+			ReceiverID:  msg.Fields[100],
+		},
+	}
+	if includeRaw {
+		envelope.Raw = msg.Raw
+	}
+	return envelope
+}
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"iso8583-gateway/pkg/element"
+	"time"
+)
+
+// Amount returns F4 in the currency of F49.
+func (m *ISO8583Message) Amount() (element.Amount, error) {
+	return element.ParseAmount(m.Fields[4], m.Fields[49])
+}
+
+// TransmissionTime returns F7 (MMDDhhmmss, UTC). F7 has no year, so the year
+// putting it closest to when the message was received is used.
+func (m *ISO8583Message) TransmissionTime() (time.Time, error) {
+	return element.ParseTransmissionTime(m.Fields[7], m.ReceivedAt)
+}
+
+// ProcessingCode returns F3.
+func (m *ISO8583Message) ProcessingCode() (element.ProcessingCode, error) {
+	return element.ParseProcessingCode(m.Fields[3])
+}
+
+// PAN returns F2.
+func (m *ISO8583Message) PAN() (element.PAN, error) {
+	return element.ParsePAN(m.Fields[2])
+}
+
+// OriginalDataElements returns F90.
+func (m *ISO8583Message) OriginalDataElements() (*element.OriginalDataElements, error) {
+	return element.ParseOriginalDataElements(m.Fields[90])
+}
@@ -1,8 +1,29 @@
 package domain
 
+import (
+	"context"
+	"time"
+)
+
 type ISO8583Message struct {
 	MTI    string         `json:"mti"`
 	Fields map[int]string `json:"fields"`
+	// Raw is the frame the message was parsed from, without its length header.
+	Raw []byte `json:"-"`
+	// ReceivedAt is when the frame was read from the connection.
+	ReceivedAt time.Time `json:"-"`
+	// Profile is the spec profile the frame was parsed with.
+	Profile string `json:"-"`
+	// Context carries the trace the message belongs to through the pipeline.
+	Context context.Context `json:"-"`
+}
+
+// TraceContext returns the context of the message's trace, or an empty one.
+func (m *ISO8583Message) TraceContext() context.Context {
+	if m.Context == nil {
+		return context.Background()
+	}
+	return m.Context
 }
 
 func NewISO8583Message(mti string, fields map[int]string) *ISO8583Message {
@@ -11,3 +32,72 @@ func NewISO8583Message(mti string, fields map[int]string) *ISO8583Message {
 		Fields: fields,
 	}
 }
+
+// NewResponse answers request with response code rc, echoing the request's
+// data elements except the MTI and bitmap.
+func NewResponse(request *ISO8583Message, rc string) *ISO8583Message {
+	fields := make(map[int]string, len(request.Fields)+1)
+	for i, f := range request.Fields {
+		if i > 1 {
+			fields[i] = f
+		}
+	}
+	fields[39] = rc
+	response := NewISO8583Message(ResponseMTI(request.MTI), fields)
+	response.Context = request.Context
+	return response
+}
+
+// ExpectsResponse reports whether the MTI is a request or an advice, which the receiver must answer.
+func ExpectsResponse(mti string) bool {
+	return len(mti) == 4 && (mti[2] == '0' || mti[2] == '2')
+}
+
+// IsAdvice reports whether the MTI is an advice, e.g. 0220 or 0420.
+func IsAdvice(mti string) bool {
+	return len(mti) == 4 && mti[2] == '2'
+}
+
+// IsReversal reports whether the MTI belongs to the reversal class, e.g. 0400 or 0420.
+func IsReversal(mti string) bool {
+	return len(mti) == 4 && mti[1] == '4'
+}
+
+// IsNetworkManagement reports whether the MTI belongs to the network management
+// class, e.g. 0800 sign-on or echo.
+func IsNetworkManagement(mti string) bool {
+	return len(mti) == 4 && mti[1] == '8'
+}
+
+// IsRepeat reports whether the MTI is a retransmission, e.g. 0201 or 0421.
+func IsRepeat(mti string) bool {
+	return len(mti) == 4 && mti[3] >= '0' && mti[3] <= '9' && (mti[3]-'0')%2 == 1
+}
+
+// ResponseMTI returns the response MTI for a request or advice MTI, e.g. 0200 -> 0210
+// or 0421 -> 0430. MTIs that are already responses are returned unchanged.
+func ResponseMTI(mti string) string {
+	if !ExpectsResponse(mti) {
+		return mti
+	}
+	origin := mti[3]
+	if IsRepeat(mti) {
+		origin--
+	}
+	return mti[:2] + string(mti[2]+1) + string(origin)
+}
+
+// RequestMTI returns the request or advice MTI a response MTI answers, e.g. 0210 -> 0200
+// or 0430 -> 0420. MTIs that are not responses are returned unchanged.
+func RequestMTI(mti string) string {
+	if len(mti) != 4 || (mti[2] != '1' && mti[2] != '3') {
+		return mti
+	}
+	return mti[:2] + string(mti[2]-1) + mti[3:]
+}
+
+// IsSignOn reports whether the message is a network management sign-on: an
+// 0800 with network management code 001.
+func (m *ISO8583Message) IsSignOn() bool {
+	return m.MTI == "0800" && m.Fields[70] == "001"
+}
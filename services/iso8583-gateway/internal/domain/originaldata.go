@@ -0,0 +1,15 @@
+package domain
+
+import "iso8583-gateway/pkg/element"
+
+// NewOriginalDataElements identifies original in the F90 of a reversal or
+// advice referring to it.
+func NewOriginalDataElements(original *ISO8583Message) *element.OriginalDataElements {
+	return &element.OriginalDataElements{
+		MTI:                  original.MTI,
+		STAN:                 original.Fields[11],
+		TransmissionDateTime: original.Fields[7],
+		AcquirerID:           original.Fields[32],
+		ForwarderID:          original.Fields[33],
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"strconv"
+)
+
+// Framing is the length header in front of every frame.
+type Framing string
+
+const (
+	// FramingASCII4 is four ASCII digits, e.g. "0123".
+	FramingASCII4 Framing = config.FramingASCII4
+	// FramingBinary2 is two bytes, big-endian.
+	FramingBinary2 Framing = config.FramingBinary2
+)
+
+func (framing Framing) headerLen() int {
+	if framing == FramingBinary2 {
+		return 2
+	}
+	return 4
+}
+
+func (framing Framing) decode(header []byte) (int, error) {
+	if framing == FramingBinary2 {
+		return int(binary.BigEndian.Uint16(header)), nil
+	}
+	return strconv.Atoi(string(header))
+}
+
+func (framing Framing) encode(length int) ([]byte, error) {
+	if framing == FramingBinary2 {
+		if length > 0xFFFF {
+			return nil, fmt.Errorf("message length %d exceeds header capacity", length)
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(length)), nil
+	}
+	if length > 9999 {
+		return nil, fmt.Errorf("message length %d exceeds header capacity", length)
+	}
+	return fmt.Appendf(nil, "%04d", length), nil
+}
@@ -7,11 +7,14 @@ import (
 	"fmt"
 	"io"
 	"iso8583-gateway/internal/domain"
-	"iso8583-gateway/pkg/util"
+	"iso8583-gateway/internal/profile"
+	"iso8583-gateway/pkg/tracing"
 	"net"
-	"strconv"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -19,13 +22,17 @@ type ISO8583Reader struct {
 	conn        net.Conn
 	ctx         context.Context
 	inboundChan chan *domain.ISO8583Message
+	selection   *profile.Selection
+	framing     Framing
 }
 
-func NewISO8583Reader(conn net.Conn, ctx context.Context, inboundChan chan *domain.ISO8583Message) *ISO8583Reader {
+func NewISO8583Reader(conn net.Conn, ctx context.Context, inboundChan chan *domain.ISO8583Message, selection *profile.Selection, framing Framing) *ISO8583Reader {
 	return &ISO8583Reader{
 		conn:        conn,
 		ctx:         ctx,
 		inboundChan: inboundChan,
+		selection:   selection,
+		framing:     framing,
 	}
 }
 
@@ -46,10 +53,20 @@ func (reader *ISO8583Reader) Read() {
 			}
 			return
 		}
+		ctx, span := tracing.Tracer().Start(reader.ctx, "iso8583.read",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("network.peer.address", remoteAddress), attribute.Int("iso8583.length", msgLen)),
+		)
 		msg, err := reader.readMessage(r, remoteAddress, msgLen)
 		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "read failed")
+			span.End()
 			return
 		}
+		span.SetAttributes(attribute.String("iso8583.mti", msg.MTI), attribute.String("iso8583.trace_id", msg.Fields[63]))
+		span.End()
+		msg.Context = ctx
 		zap.L().Info("ISO8583 message parsed", zap.String("remote_addr", remoteAddress), zap.String("mti", msg.MTI), zap.Any("fields", msg.Fields))
 		reader.inboundChan <- msg
 	}
@@ -65,7 +82,7 @@ func (reader *ISO8583Reader) isShuttingDown() bool {
 }
 
 func (reader *ISO8583Reader) readMessageLength(r *bufio.Reader, remoteAddress string) (int, error) {
-	lenBuf := make([]byte, 4)
+	lenBuf := make([]byte, reader.framing.headerLen())
 	err := reader.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 	if err != nil {
 		zap.L().Error("Error setting read deadline", zap.String("remote_addr", remoteAddress), zap.Error(err))
@@ -80,7 +97,7 @@ func (reader *ISO8583Reader) readMessageLength(r *bufio.Reader, remoteAddress st
 		zap.L().Info("Client disconnected", zap.String("remote_addr", remoteAddress))
 		return 0, err
 	}
-	msgLen, err := strconv.Atoi(string(lenBuf))
+	msgLen, err := reader.framing.decode(lenBuf)
 	if err != nil || msgLen < 0 || msgLen > 2048 {
 		zap.L().Warn("Invalid header length, closing connection", zap.String("remote_addr", remoteAddress), zap.Error(err))
 		return 0, err
@@ -96,11 +113,18 @@ func (reader *ISO8583Reader) readMessage(r *bufio.Reader, remoteAddress string,
 		return nil, err
 	}
 	zap.L().Info("Raw message received", zap.String("remote_addr", remoteAddress), zap.String("raw_message", fmt.Sprintf("% X", msgBuf)))
-	msg, err := util.ParseISO8583(msgBuf)
+	p := reader.selection.Profile()
+	msg, err := p.Parse(msgBuf)
 	if err != nil {
-		zap.L().Error("Fail to parse ISO8583 message", zap.String("remote_addr", remoteAddress), zap.Error(err))
+		zap.L().Error("Fail to parse ISO8583 message", zap.String("remote_addr", remoteAddress), zap.String("profile", p.Name), zap.Error(err))
 		return nil, err
 	}
+	msg.Profile = p.Name
+	// Switch before reading on, so the frames after a sign-on are read in
+	// the institution's profile.
+	reader.selection.SignOn(msg)
+	msg.Raw = msgBuf
+	msg.ReceivedAt = time.Now()
 	return msg, nil
 }
 
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"fmt"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/profile"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const writeTimeout = 5 * time.Second
+
+type ISO8583Writer struct {
+	conn      net.Conn
+	selection *profile.Selection
+	framing   Framing
+	mu        sync.Mutex
+}
+
+func NewISO8583Writer(conn net.Conn, selection *profile.Selection, framing Framing) *ISO8583Writer {
+	return &ISO8583Writer{
+		conn:      conn,
+		selection: selection,
+		framing:   framing,
+	}
+}
+
+// Write packs msg and sends it to the peer. It returns the packed message
+// without its length header.
+func (writer *ISO8583Writer) Write(msg *domain.ISO8583Message) ([]byte, error) {
+	data, err := writer.selection.Profile().Pack(msg)
+	if err != nil {
+		return nil, err
+	}
+	return data, writer.WriteRaw(data)
+}
+
+// WriteRaw sends an already packed message to the peer.
+func (writer *ISO8583Writer) WriteRaw(data []byte) error {
+	header, err := writer.framing.encode(len(data))
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 0, len(header)+len(data))
+	frame = append(frame, header...)
+	frame = append(frame, data...)
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if err := writer.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	if _, err := writer.conn.Write(frame); err != nil {
+		return err
+	}
+	zap.L().Info("Raw message sent", zap.String("remote_addr", writer.conn.RemoteAddr().String()), zap.String("raw_message", fmt.Sprintf("% X", data)))
+	return nil
+}
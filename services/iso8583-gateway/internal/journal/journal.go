@@ -0,0 +1,424 @@
+package journal
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/pkg/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusReceived        = "received"
+	StatusPublished       = "published"
+	StatusPublishFailed   = "publish_failed"
+	StatusDeadLettered    = "dead_lettered"
+	StatusResponded       = "responded"
+	StatusRejected        = "rejected"
+	StatusTimedOut        = "timed_out"
+	StatusReversalPending = "reversal_pending"
+	StatusReversed        = "reversed"
+
+	fileDateLayout = "20060102"
+	filePrefix     = "journal-"
+	fileSuffix     = ".db"
+)
+
+var (
+	bucketTransactions = []byte("transactions")
+	bucketKeys         = []byte("keys")
+	bucketDedupeKeys   = []byte("dedupe_keys")
+
+	ErrNotFound = errors.New("transaction not found in journal")
+)
+
+// Message is one side of a transaction as journaled: the redacted fields and
+// the encrypted raw frame.
+type Message struct {
+	MTI      string         `json:"mti"`
+	Fields   map[int]string `json:"fields"`
+	RawFrame []byte         `json:"raw_frame,omitempty"`
+	At       time.Time      `json:"at"`
+}
+
+// Transaction is the journal record of a request and, once answered, its response.
+type Transaction struct {
+	TraceID                string    `json:"trace_id"`
+	Key                    string    `json:"key"`
+	DedupeKey              string    `json:"dedupe_key"`
+	SessionID              string    `json:"session_id"`
+	RemoteAddr             string    `json:"remote_addr"`
+	DestinationAccountHash string    `json:"destination_account_hash,omitempty"`
+	Status                 string    `json:"status"`
+	Request                *Message  `json:"request"`
+	Response               *Message  `json:"response,omitempty"`
+	Topic                  string    `json:"topic,omitempty"`
+	Partition              int32     `json:"partition"`
+	Offset                 int64     `json:"offset"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+// Journal is the durable record of every transaction handled by this
+// instance. Records are written to one bbolt file per UTC day, named after
+// the day the request was received; files older than the retention period
+// are deleted.
+type Journal struct {
+	dir       string
+	retention time.Duration
+	aead      cipher.AEAD
+	hashKey   []byte
+	mu        sync.Mutex
+	files     map[string]*bbolt.DB
+}
+
+func Open(cfg *config.JournalConfig) (*Journal, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("fail to create journal directory: %w", err)
+	}
+	j := &Journal{
+		dir:       cfg.Dir,
+		retention: cfg.Retention,
+		files:     make(map[string]*bbolt.DB),
+	}
+	if cfg.KeyFile != "" {
+		aead, err := LoadKey(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		j.aead = aead
+	}
+	if cfg.HashKeyFile != "" {
+		hashKey, err := readKey(cfg.HashKeyFile, "journal hash key")
+		if err != nil {
+			return nil, err
+		}
+		j.hashKey = hashKey
+	}
+	if err := j.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// NewMessage prepares a message for the journal, redacting its fields and
+// encrypting its raw frame. Without an encryption key the raw frame is not kept.
+func (j *Journal) NewMessage(v *domain.ISO8583Message, raw []byte, at time.Time) (*Message, error) {
+	m := &Message{
+		MTI:    v.MTI,
+		Fields: util.RedactFields(v.Fields),
+		At:     at,
+	}
+	if j.aead != nil && len(raw) > 0 {
+		nonce := make([]byte, j.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("fail to generate nonce: %w", err)
+		}
+		m.RawFrame = j.aead.Seal(nonce, nonce, raw, nil)
+	}
+	return m, nil
+}
+
+// HashAccount returns the keyed hash an account number is journaled and
+// searched by, or "" without a hash key.
+func (j *Journal) HashAccount(account string) string {
+	return util.HashValue(j.hashKey, account)
+}
+
+// DecryptFrame returns the raw frame of a journaled message.
+func (j *Journal) DecryptFrame(m *Message) ([]byte, error) {
+	if j.aead == nil || len(m.RawFrame) == 0 {
+		return nil, errors.New("raw frame not available")
+	}
+	size := j.aead.NonceSize()
+	if len(m.RawFrame) < size {
+		return nil, errors.New("raw frame too short")
+	}
+	return j.aead.Open(nil, m.RawFrame[:size], m.RawFrame[size:], nil)
+}
+
+// Put stores a new transaction in the file of the day its request was received.
+func (j *Journal) Put(t *Transaction) error {
+	t.UpdatedAt = time.Now().UTC()
+	db, err := j.file(t.Request.At)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return putTransaction(tx, t)
+	})
+}
+
+// Update applies fn to the transaction with the given trace ID and stores the result.
+func (j *Journal) Update(traceID string, fn func(t *Transaction)) error {
+	for _, db := range j.newestFirst() {
+		var found bool
+		err := db.View(func(tx *bbolt.Tx) error {
+			found = tx.Bucket(bucketTransactions).Get([]byte(traceID)) != nil
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		return db.Update(func(tx *bbolt.Tx) error {
+			t, err := getTransaction(tx, traceID)
+			if err != nil || t == nil {
+				return err
+			}
+			fn(t)
+			t.UpdatedAt = time.Now().UTC()
+			return putTransaction(tx, t)
+		})
+	}
+	return ErrNotFound
+}
+
+func (j *Journal) Get(traceID string) (*Transaction, error) {
+	return j.find(time.Time{}, func(tx *bbolt.Tx) (*Transaction, error) {
+		return getTransaction(tx, traceID)
+	})
+}
+
+// FindByKey returns the newest transaction with the given STAN+F7+F32 key.
+func (j *Journal) FindByKey(key string) (*Transaction, error) {
+	return j.findByIndex(bucketKeys, key, time.Time{})
+}
+
+// FindByDedupeKey returns the newest transaction received since the given
+// time with the given F32+F11+F7+F37 key.
+func (j *Journal) FindByDedupeKey(key string, since time.Time) (*Transaction, error) {
+	t, err := j.findByIndex(bucketDedupeKeys, key, since)
+	if err == nil && t.Request.At.Before(since) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+func (j *Journal) findByIndex(bucket []byte, key string, since time.Time) (*Transaction, error) {
+	return j.find(since, func(tx *bbolt.Tx) (*Transaction, error) {
+		traceID := tx.Bucket(bucket).Get([]byte(key))
+		if traceID == nil {
+			return nil, nil
+		}
+		return getTransaction(tx, string(traceID))
+	})
+}
+
+// find returns the first transaction found by lookup, searching the files
+// from the newest day back to the day of since.
+func (j *Journal) find(since time.Time, lookup func(tx *bbolt.Tx) (*Transaction, error)) (*Transaction, error) {
+	for _, db := range j.newestFirstSince(since) {
+		var t *Transaction
+		err := db.View(func(tx *bbolt.Tx) error {
+			var err error
+			t, err = lookup(tx)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			return t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Run applies the rotation and retention policies hourly until ctx is done.
+func (j *Journal) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := j.rotate(now); err != nil {
+				zap.L().Error("Failed to rotate journal", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var errs []error
+	for day, db := range j.files {
+		errs = append(errs, db.Close())
+		delete(j.files, day)
+	}
+	return errors.Join(errs...)
+}
+
+// rotate opens the files still within retention, creating today's, and
+// deletes the ones that fell out of it.
+func (j *Journal) rotate(now time.Time) error {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return fmt.Errorf("fail to list journal directory: %w", err)
+	}
+	cutoff := now.UTC().Add(-j.retention).Format(fileDateLayout)
+	for _, e := range entries {
+		day, ok := strings.CutPrefix(e.Name(), filePrefix)
+		if !ok {
+			continue
+		}
+		day, ok = strings.CutSuffix(day, fileSuffix)
+		if !ok {
+			continue
+		}
+		if day < cutoff {
+			if err := j.remove(day); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := j.open(day); err != nil {
+			return err
+		}
+	}
+	_, err = j.file(now)
+	return err
+}
+
+func (j *Journal) file(at time.Time) (*bbolt.DB, error) {
+	return j.open(at.UTC().Format(fileDateLayout))
+}
+
+func (j *Journal) open(day string) (*bbolt.DB, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if db, ok := j.files[day]; ok {
+		return db, nil
+	}
+	db, err := bbolt.Open(filepath.Join(j.dir, filePrefix+day+fileSuffix), 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("fail to open journal file for %s: %w", day, err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{bucketTransactions, bucketKeys, bucketDedupeKeys} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("fail to initialise journal file for %s: %w", day, err)
+	}
+	j.files[day] = db
+	return db, nil
+}
+
+func (j *Journal) remove(day string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if db, ok := j.files[day]; ok {
+		if err := db.Close(); err != nil {
+			return fmt.Errorf("fail to close expired journal file for %s: %w", day, err)
+		}
+		delete(j.files, day)
+	}
+	if err := os.Remove(filepath.Join(j.dir, filePrefix+day+fileSuffix)); err != nil {
+		return fmt.Errorf("fail to delete expired journal file for %s: %w", day, err)
+	}
+	return nil
+}
+
+func (j *Journal) newestFirst() []*bbolt.DB {
+	return j.newestFirstSince(time.Time{})
+}
+
+func (j *Journal) newestFirstSince(since time.Time) []*bbolt.DB {
+	days := j.days(since, time.Time{})
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	dbs := make([]*bbolt.DB, 0, len(days))
+	for _, day := range days {
+		if db, ok := j.files[day]; ok {
+			dbs = append(dbs, db)
+		}
+	}
+	return dbs
+}
+
+func getTransaction(tx *bbolt.Tx, traceID string) (*Transaction, error) {
+	data := tx.Bucket(bucketTransactions).Get([]byte(traceID))
+	if data == nil {
+		return nil, nil
+	}
+	var t Transaction
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("fail to parse journal record %s: %w", traceID, err)
+	}
+	return &t, nil
+}
+
+func putTransaction(tx *bbolt.Tx, t *Transaction) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("fail to marshal journal record %s: %w", t.TraceID, err)
+	}
+	if err := tx.Bucket(bucketTransactions).Put([]byte(t.TraceID), data); err != nil {
+		return err
+	}
+	if t.Key != "" {
+		if err := tx.Bucket(bucketKeys).Put([]byte(t.Key), []byte(t.TraceID)); err != nil {
+			return err
+		}
+	}
+	if t.DedupeKey != "" {
+		if err := tx.Bucket(bucketDedupeKeys).Put([]byte(t.DedupeKey), []byte(t.TraceID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadKey reads a hex encoded 256-bit AES key, the journal key raw frames
+// and pending reversals are encrypted with.
+func LoadKey(path string) (cipher.AEAD, error) {
+	key, err := readKey(path, "journal key")
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("fail to create journal cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// readKey reads a hex encoded 256-bit key.
+func readKey(path string, name string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read %s: %w", name, err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s must be hex encoded: %w", name, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s must be 32 bytes, got %d", name, len(key))
+	}
+	return key, nil
+}
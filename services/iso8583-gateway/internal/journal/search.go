@@ -0,0 +1,156 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iso8583-gateway/pkg/element"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Filter selects journal transactions. Empty criteria match everything.
+// TransmissionFrom and TransmissionTo bound F7, which is read in the year
+// closest to the time the request was received, so a range can span the end
+// of a year.
+type Filter struct {
+	RRN                    string
+	STAN                   string
+	TransmissionFrom       time.Time
+	TransmissionTo         time.Time
+	AcquirerID             string
+	DestinationAccountHash string
+	ResponseCode           string
+	ProcessingCode         string
+	ReceivedFrom           time.Time
+	ReceivedTo             time.Time
+}
+
+func (f *Filter) match(t *Transaction) bool {
+	request := t.Request.Fields
+	switch {
+	case f.RRN != "" && request[37] != f.RRN,
+		f.STAN != "" && request[11] != f.STAN,
+		f.AcquirerID != "" && request[32] != f.AcquirerID,
+		f.DestinationAccountHash != "" && t.DestinationAccountHash != f.DestinationAccountHash,
+		f.ProcessingCode != "" && !strings.HasPrefix(request[3], f.ProcessingCode),
+		!f.ReceivedFrom.IsZero() && t.Request.At.Before(f.ReceivedFrom),
+		!f.ReceivedTo.IsZero() && t.Request.At.After(f.ReceivedTo):
+		return false
+	}
+	if f.ResponseCode != "" && (t.Response == nil || t.Response.Fields[39] != f.ResponseCode) {
+		return false
+	}
+	if !f.TransmissionFrom.IsZero() || !f.TransmissionTo.IsZero() {
+		sent, err := element.ParseTransmissionTime(request[7], t.Request.At)
+		if err != nil || !f.TransmissionFrom.IsZero() && sent.Before(f.TransmissionFrom) || !f.TransmissionTo.IsZero() && sent.After(f.TransmissionTo) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns up to limit transactions matching filter, newest day first,
+// and a token for the next page, or "" on the last page.
+func (j *Journal) Search(filter *Filter, pageToken string, limit int) ([]*Transaction, string, error) {
+	startDay, startAfter, err := decodePageToken(pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	days := j.days(filter.ReceivedFrom, filter.ReceivedTo)
+	var result []*Transaction
+	// lastDay is the day of the last transaction in result, which the next
+	// page resumes from.
+	var lastDay string
+	for _, day := range days {
+		if startDay != "" && day > startDay {
+			continue
+		}
+		after := []byte(nil)
+		if day == startDay {
+			after = startAfter
+		}
+		db, err := j.open(day)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		err = db.View(func(tx *bbolt.Tx) error {
+			c := tx.Bucket(bucketTransactions).Cursor()
+			k, v := c.First()
+			if after != nil {
+				k, v = c.Seek(after)
+				if k != nil && bytes.Equal(k, after) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil; k, v = c.Next() {
+				var t Transaction
+				if err := json.Unmarshal(v, &t); err != nil {
+					return fmt.Errorf("fail to parse journal record %s: %w", k, err)
+				}
+				if !filter.match(&t) {
+					continue
+				}
+				if len(result) == limit {
+					next = encodePageToken(lastDay, result[len(result)-1].TraceID)
+					return nil
+				}
+				result = append(result, &t)
+				lastDay = day
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		if next != "" {
+			return result, next, nil
+		}
+	}
+	return result, "", nil
+}
+
+// days lists the open journal days overlapping [from, to], newest first.
+func (j *Journal) days(from time.Time, to time.Time) []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	days := make([]string, 0, len(j.files))
+	for day := range j.files {
+		if !from.IsZero() && day < from.UTC().Format(fileDateLayout) {
+			continue
+		}
+		if !to.IsZero() && day > to.UTC().Format(fileDateLayout) {
+			continue
+		}
+		days = append(days, day)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	return days
+}
+
+func encodePageToken(day string, traceID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(day + "/" + traceID))
+}
+
+func decodePageToken(token string) (string, []byte, error) {
+	if token == "" {
+		return "", nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", nil, ErrInvalidPageToken
+	}
+	day, traceID, ok := strings.Cut(string(data), "/")
+	if !ok || len(day) != len(fileDateLayout) {
+		return "", nil, ErrInvalidPageToken
+	}
+	return day, []byte(traceID), nil
+}
@@ -0,0 +1,96 @@
+package journal
+
+import (
+	"iso8583-gateway/internal/config"
+	"testing"
+	"time"
+)
+
+// A page that fills up with the last transaction of one day must resume the
+// next page after it, and still return every transaction of the older days.
+func TestSearchPagesAcrossDays(t *testing.T) {
+	j, err := Open(&config.JournalConfig{Dir: t.TempDir(), Retention: 72 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = j.Close() }()
+
+	today := time.Now().UTC()
+	yesterday := today.Add(-24 * time.Hour)
+	// Trace IDs of the older day sort before those of the newer one.
+	records := map[string]time.Time{"t-1": today, "t-2": today, "a-1": yesterday, "a-2": yesterday, "a-3": yesterday}
+	for traceID, at := range records {
+		err := j.Put(&Transaction{TraceID: traceID, Status: StatusPublished, Request: &Message{MTI: "0200", Fields: map[int]string{11: "000001"}, At: at}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pageSize := range []int{1, 2, 3, 5} {
+		seen := make(map[string]bool)
+		token := ""
+		for pages := 0; ; pages++ {
+			if pages > len(records) {
+				t.Fatalf("page size %d: too many pages", pageSize)
+			}
+			result, next, err := j.Search(&Filter{}, token, pageSize)
+			if err != nil {
+				t.Fatalf("page size %d: %v", pageSize, err)
+			}
+			if len(result) > pageSize {
+				t.Fatalf("page size %d: got %d results", pageSize, len(result))
+			}
+			for _, transaction := range result {
+				if seen[transaction.TraceID] {
+					t.Errorf("page size %d: %s returned twice", pageSize, transaction.TraceID)
+				}
+				seen[transaction.TraceID] = true
+			}
+			if next == "" {
+				break
+			}
+			token = next
+		}
+		if len(seen) != len(records) {
+			t.Errorf("page size %d: got %d transactions, want %d: %v", pageSize, len(seen), len(records), seen)
+		}
+	}
+}
+
+// F7 carries no year, so a range across the new year must still match the
+// transactions on both sides of it.
+func TestSearchTransmissionAcrossYearEnd(t *testing.T) {
+	j, err := Open(&config.JournalConfig{Dir: t.TempDir(), Retention: 5 * 365 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = j.Close() }()
+
+	for traceID, at := range map[string]time.Time{
+		"december":      time.Date(2025, 12, 31, 23, 59, 50, 0, time.UTC),
+		"january":       time.Date(2026, 1, 1, 0, 0, 10, 0, time.UTC),
+		"june":          time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+		"last-december": time.Date(2024, 12, 31, 23, 59, 55, 0, time.UTC),
+	} {
+		err := j.Put(&Transaction{TraceID: traceID, Status: StatusPublished, Request: &Message{MTI: "0200", Fields: map[int]string{7: at.Format("0102150405")}, At: at}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := &Filter{
+		TransmissionFrom: time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC),
+		TransmissionTo:   time.Date(2026, 1, 1, 0, 1, 0, 0, time.UTC),
+	}
+	result, _, err := j.Search(filter, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, transaction := range result {
+		got[transaction.TraceID] = true
+	}
+	if len(got) != 2 || !got["december"] || !got["january"] {
+		t.Errorf("got %v, want december and january", got)
+	}
+}
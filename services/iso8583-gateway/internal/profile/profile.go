@@ -0,0 +1,163 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/pkg/util"
+	"net/netip"
+	"os"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// Default is the built-in NAPAS profile.
+const Default = "napas"
+
+// Profile is the dialect a partner speaks: how it encodes the fields and
+// which fields differ from NAPAS. A profile is chosen for a connection by its
+// peer address, then by the listener, and changes when a sign-on names one of
+// its institutions.
+type Profile struct {
+	Name         string                   `json:"name"`
+	Encodings    util.Encodings           `json:"encodings"`
+	Fields       map[int]util.FieldFormat `json:"fields,omitempty"`
+	Peers        []string                 `json:"peers,omitempty"`
+	Institutions []string                 `json:"institutions,omitempty"`
+
+	spec  *util.Spec
+	peers []netip.Prefix
+}
+
+// Parse unpacks a message without its length header.
+func (p *Profile) Parse(data []byte) (*domain.ISO8583Message, error) {
+	return p.spec.Parse(data)
+}
+
+// Pack packs a message without its length header.
+func (p *Profile) Pack(msg *domain.ISO8583Message) ([]byte, error) {
+	return p.spec.Pack(msg)
+}
+
+type file struct {
+	Profiles []*Profile `json:"profiles"`
+}
+
+// Registry holds the built-in napas profile and the profiles of the profiles
+// file, which may redefine it.
+type Registry struct {
+	profiles     map[string]*Profile
+	ordered      []*Profile
+	institutions map[string]*Profile
+}
+
+// Load builds the profiles of the profiles file, if any.
+func Load(cfg *config.ProfileConfig) (*Registry, error) {
+	napas := &Profile{Name: Default, Encodings: util.DefaultEncodings}
+	if err := napas.build(); err != nil {
+		return nil, err
+	}
+	registry := &Registry{profiles: map[string]*Profile{Default: napas}, institutions: map[string]*Profile{}}
+	if cfg.File == "" {
+		return registry, nil
+	}
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("read profiles file: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse profiles file %s: %w", cfg.File, err)
+	}
+	seen := make(map[string]bool, len(f.Profiles))
+	for _, p := range f.Profiles {
+		if p.Name == "" {
+			return nil, errors.New("profile name is required")
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate profile name %q", p.Name)
+		}
+		seen[p.Name] = true
+		if err := p.build(); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+		for _, institution := range p.Institutions {
+			if other, ok := registry.institutions[institution]; ok {
+				return nil, fmt.Errorf("institution %s is in profiles %q and %q", institution, other.Name, p.Name)
+			}
+			registry.institutions[institution] = p
+		}
+		registry.profiles[p.Name] = p
+		registry.ordered = append(registry.ordered, p)
+	}
+	zap.L().Info("Loaded spec profiles", zap.String("file", cfg.File), zap.Strings("profiles", registry.Names()))
+	return registry, nil
+}
+
+func (p *Profile) build() error {
+	spec, err := util.NewSpec(p.Encodings, p.Fields)
+	if err != nil {
+		return err
+	}
+	for _, peer := range p.Peers {
+		prefix, err := util.ParsePrefix(peer)
+		if err != nil {
+			return fmt.Errorf("peer %w", err)
+		}
+		p.peers = append(p.peers, prefix)
+	}
+	p.Encodings = spec.Encodings
+	p.spec = spec
+	return nil
+}
+
+// Get returns the profile with the given name.
+func (registry *Registry) Get(name string) (*Profile, bool) {
+	p, ok := registry.profiles[name]
+	return p, ok
+}
+
+// ForPeer returns the first profile, in file order, listing the address of
+// the peer.
+func (registry *Registry) ForPeer(remoteAddr string) (*Profile, bool) {
+	addr, ok := util.RemoteIP(remoteAddr)
+	if !ok {
+		return nil, false
+	}
+	for _, p := range registry.ordered {
+		for _, prefix := range p.peers {
+			if prefix.Contains(addr) {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// ForInstitution returns the profile listing the institution.
+func (registry *Registry) ForInstitution(institution string) (*Profile, bool) {
+	p, ok := registry.institutions[institution]
+	return p, ok
+}
+
+// Institutions returns the institutions listed by the profiles.
+func (registry *Registry) Institutions() []string {
+	institutions := make([]string, 0, len(registry.institutions))
+	for institution := range registry.institutions {
+		institutions = append(institutions, institution)
+	}
+	return institutions
+}
+
+// Names returns the profile names, sorted.
+func (registry *Registry) Names() []string {
+	names := make([]string, 0, len(registry.profiles))
+	for name := range registry.profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
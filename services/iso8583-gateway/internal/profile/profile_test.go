@@ -0,0 +1,116 @@
+package profile
+
+import (
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// profilesFile is the example of the README.
+const profilesFile = `{
+  "profiles": [
+    {
+      "name": "partnerA",
+      "encodings": {"numeric": "bcd", "text": "ebcdic", "bitmap": "hex", "binary": "binary"},
+      "fields": {"103": {"length": 34}},
+      "peers": ["10.1.0.0/16"],
+      "institutions": ["970436"]
+    },
+    {
+      "name": "partnerB",
+      "encodings": {"bitmap": "hex"},
+      "fields": {"43": {"length": 99, "prefix": "ll"}, "47": {"kind": "text", "length": 50, "prefix": "ll"}},
+      "peers": ["192.168.1.5"]
+    }
+  ]
+}`
+
+func loadProfiles(t *testing.T) *Registry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(profilesFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := Load(&config.ProfileConfig{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+// TestProfileRoundTrip packs a message in every profile of the file and
+// checks that it parses back the same.
+func TestProfileRoundTrip(t *testing.T) {
+	registry := loadProfiles(t)
+	fields := map[int]string{
+		2:   "9704366614952070",
+		3:   "912000",
+		4:   "000001500000",
+		7:   "1019093015",
+		11:  "000123",
+		32:  "970436",
+		37:  "629209123456",
+		41:  "ATM00001",
+		49:  "704",
+		52:  "0123456789ABCDEF",
+		55:  "9F2608C2A1B3D4E5F60718",
+		100: "970400",
+		103: "0123456789",
+	}
+	overrides := map[string]map[int]string{
+		"partnerA": {103: "0123456789012345678901234567890123"},
+		"partnerB": {43: "GATEWAY TEST HANOI VN", 47: "PARTNER B PRIVATE DATA"},
+	}
+	for _, name := range []string{Default, "partnerA", "partnerB"} {
+		t.Run(name, func(t *testing.T) {
+			p, ok := registry.Get(name)
+			if !ok {
+				t.Fatalf("profile %s not loaded", name)
+			}
+			msgFields := maps.Clone(fields)
+			maps.Copy(msgFields, overrides[name])
+			msg := domain.NewISO8583Message("0200", msgFields)
+			data, err := p.Pack(msg)
+			if err != nil {
+				t.Fatalf("pack: %v", err)
+			}
+			parsed, err := p.Parse(data)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got := maps.Clone(parsed.Fields)
+			delete(got, 0)
+			delete(got, 1)
+			if parsed.MTI != msg.MTI || !maps.Equal(got, msg.Fields) {
+				t.Errorf("parsed %s %v, want %s %v", parsed.MTI, got, msg.MTI, msg.Fields)
+			}
+		})
+	}
+}
+
+func TestProfileSelection(t *testing.T) {
+	registry := loadProfiles(t)
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"10.1.2.3:5000", "partnerA"},
+		{"192.168.1.5:5000", "partnerB"},
+		{"192.168.1.6:5000", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if p, ok := registry.ForPeer(tt.remoteAddr); ok {
+			got = p.Name
+		}
+		if got != tt.want {
+			t.Errorf("ForPeer(%s) = %q, want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+	if p, ok := registry.ForInstitution("970436"); !ok || p.Name != "partnerA" {
+		t.Errorf("ForInstitution(970436) = %v, %v, want partnerA", p, ok)
+	}
+}
@@ -0,0 +1,53 @@
+package profile
+
+import (
+	"iso8583-gateway/internal/domain"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// Selection is the profile a connection currently speaks. Frames are read and
+// written with it, and a sign-on can switch it to the profile of the
+// institution signing on.
+type Selection struct {
+	registry *Registry
+	current  atomic.Pointer[Profile]
+}
+
+// Select starts the selection of a connection: the profile listing the peer,
+// or else the listener's.
+func (registry *Registry) Select(listener *Profile, remoteAddr string) *Selection {
+	selection := &Selection{registry: registry}
+	p, ok := registry.ForPeer(remoteAddr)
+	if !ok {
+		p = listener
+	}
+	selection.current.Store(p)
+	return selection
+}
+
+// Profile returns the current profile.
+func (selection *Selection) Profile() *Profile {
+	return selection.current.Load()
+}
+
+// SignOn switches to the profile of the institution signing on with msg, if
+// it has one. The sign-on itself is answered in the new profile.
+func (selection *Selection) SignOn(msg *domain.ISO8583Message) {
+	if !msg.IsSignOn() {
+		return
+	}
+	institution := msg.Fields[32]
+	if institution == "" {
+		institution = msg.Fields[33]
+	}
+	p, ok := selection.registry.ForInstitution(institution)
+	if !ok {
+		return
+	}
+	previous := selection.current.Swap(p)
+	if previous != p {
+		zap.L().Info("Switched spec profile on sign-on", zap.String("institution", institution), zap.String("from", previous.Name), zap.String("to", p.Name))
+	}
+}
@@ -0,0 +1,78 @@
+package publisher
+
+import "sync"
+
+// Memory keeps published messages in memory. It is meant for tests and for
+// running the gateway locally without a broker.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(msg *Message) (Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return Receipt{}, m.err
+	}
+	m.messages = append(m.messages, *msg)
+	return Receipt{Offset: int64(len(m.messages) - 1)}, nil
+}
+
+// Transactional reports true: the memory sink keeps all or none of the
+// messages of a transaction.
+func (m *Memory) Transactional() bool {
+	return true
+}
+
+func (m *Memory) PublishTransaction(msgs []*Message) ([]Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	receipts := make([]Receipt, len(msgs))
+	for i, msg := range msgs {
+		m.messages = append(m.messages, *msg)
+		receipts[i] = Receipt{Offset: int64(len(m.messages) - 1)}
+	}
+	return receipts, nil
+}
+
+// Messages returns the messages published so far, optionally only those
+// published to topic.
+func (m *Memory) Messages(topic string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []Message
+	for _, msg := range m.messages {
+		if topic == "" || msg.Topic == topic {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// FailWith makes the following Publish calls fail with err, or succeed again
+// when err is nil.
+func (m *Memory) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+	m.err = nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package publisher
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	for _, topic := range []string{"a", "b", "a"} {
+		if _, err := m.Publish(&Message{Topic: topic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(m.Messages("a")); got != 2 {
+		t.Errorf("got %d messages on a, want 2", got)
+	}
+	if got := len(m.Messages("")); got != 3 {
+		t.Errorf("got %d messages, want 3", got)
+	}
+
+	failure := errors.New("unavailable")
+	m.FailWith(failure)
+	if _, err := m.Publish(&Message{Topic: "a"}); !errors.Is(err, failure) {
+		t.Errorf("Publish error = %v, want %v", err, failure)
+	}
+	if got := len(m.Messages("")); got != 3 {
+		t.Errorf("failed publish was stored, got %d messages", got)
+	}
+
+	m.Reset()
+	if got := len(m.Messages("")); got != 0 {
+		t.Errorf("got %d messages after Reset, want 0", got)
+	}
+	receipt, err := m.Publish(&Message{Topic: "a"})
+	if err != nil || receipt.Offset != 0 {
+		t.Errorf("Publish after Reset = %+v, %v, want offset 0", receipt, err)
+	}
+}
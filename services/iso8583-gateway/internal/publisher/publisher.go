@@ -0,0 +1,49 @@
+package publisher
+
+// Sink names accepted by PUBLISHER_SINK.
+const (
+	SinkKafka  = "kafka"
+	SinkNATS   = "nats"
+	SinkFile   = "file"
+	SinkMemory = "memory"
+)
+
+type Header struct {
+	Key   string
+	Value string
+}
+
+// Message is a record handed to a Publisher. Topic is the Kafka topic, or the
+// subject or stream name of other sinks. Key is optional.
+type Message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers []Header
+}
+
+// Receipt tells where a message was stored. Sinks without partitions report
+// partition 0 and a sequence number as the offset.
+type Receipt struct {
+	Partition int32
+	Offset    int64
+}
+
+// Publisher delivers the gateway's outgoing records: requests, reversals,
+// advices, forwarded responses and session directory entries. Publish returns
+// once the sink has accepted the message.
+type Publisher interface {
+	Publish(msg *Message) (Receipt, error)
+	Close() error
+}
+
+// Transactional is a Publisher that can publish several messages atomically,
+// the kafka sink with KAFKA_TRANSACTIONAL_ID.
+type Transactional interface {
+	Publisher
+	// Transactional reports whether PublishTransaction is available.
+	Transactional() bool
+	// PublishTransaction publishes msgs in one transaction: either all of them
+	// are committed, or none.
+	PublishTransaction(msgs []*Message) ([]Receipt, error)
+}
@@ -0,0 +1,36 @@
+package publisher
+
+import "context"
+
+// Record is a record read by a Subscriber.
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+}
+
+// Header returns the value of the header key, or "" when it is absent.
+func (r *Record) Header(key string) string {
+	for _, h := range r.Headers {
+		if h.Key == key {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// Subscriber reads the records the gateway consumes: backend responses and
+// session directory entries. Only the Kafka sink has one; with other sinks
+// the gateway publishes requests but reads no responses.
+type Subscriber interface {
+	Partitions(topic string) ([]int32, error)
+	// Partition returns the partition of topic that records keyed with key
+	// are written to.
+	Partition(topic string, key string) (int32, error)
+	// Subscribe feeds every record of the partitions to handle until ctx is
+	// done, starting from the oldest record or from new ones only.
+	Subscribe(ctx context.Context, topic string, partitions []int32, fromOldest bool, handle func(*Record)) error
+}
@@ -0,0 +1,207 @@
+package reversal
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iso8583-gateway/internal/domain"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Pending is a reversal advice sent to the backend and not yet acknowledged with an 0430.
+type Pending struct {
+	TraceID         string                 `json:"trace_id"`
+	OriginalTraceID string                 `json:"original_trace_id"`
+	Message         *domain.ISO8583Message `json:"message"`
+	Attempts        int                    `json:"attempts"`
+	CreatedAt       time.Time              `json:"created_at"`
+	LastSentAt      time.Time              `json:"last_sent_at"`
+}
+
+// FileStore keeps pending reversals in a JSON file so they survive restarts.
+// The whole set is rewritten on every change; it only ever holds the
+// reversals still waiting for an acknowledgement. Reversals carry the card
+// and account numbers of the transfer, so with a key the file is sealed with
+// AES-GCM, like the raw frames of the journal.
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	aead    cipher.AEAD
+	pending map[string]*Pending
+}
+
+// sealedFile is the content of a store written with a key.
+type sealedFile struct {
+	Sealed []byte `json:"sealed"`
+}
+
+// NewFileStore loads the pending reversals of the file at path, if any. A
+// nil aead keeps them unencrypted. A file written without a key is read with
+// one and sealed on the next change.
+func NewFileStore(path string, aead cipher.AEAD) (*FileStore, error) {
+	store := &FileStore{
+		path:    path,
+		aead:    aead,
+		pending: make(map[string]*Pending),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fail to read reversal store: %w", err)
+	}
+	data, err = store.open(data)
+	if err != nil {
+		return nil, err
+	}
+	var pending []*Pending
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("fail to parse reversal store: %w", err)
+	}
+	for _, p := range pending {
+		store.pending[p.TraceID] = p
+	}
+	return store, nil
+}
+
+// open returns the pending reversals of a file, unsealing it if it was
+// written with a key.
+func (store *FileStore) open(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != '{' {
+		return data, nil
+	}
+	if store.aead == nil {
+		return nil, errors.New("reversal store is encrypted and no key is set")
+	}
+	var sealed sealedFile
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, fmt.Errorf("fail to parse reversal store: %w", err)
+	}
+	size := store.aead.NonceSize()
+	if len(sealed.Sealed) < size {
+		return nil, errors.New("reversal store is too short")
+	}
+	data, err := store.aead.Open(nil, sealed.Sealed[:size], sealed.Sealed[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decrypt reversal store: %w", err)
+	}
+	return data, nil
+}
+
+// seal encrypts the pending reversals when the store has a key.
+func (store *FileStore) seal(data []byte) ([]byte, error) {
+	if store.aead == nil {
+		return data, nil
+	}
+	nonce := make([]byte, store.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("fail to generate nonce: %w", err)
+	}
+	return json.Marshal(sealedFile{Sealed: store.aead.Seal(nonce, nonce, data, nil)})
+}
+
+func (store *FileStore) Save(p *Pending) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.pending[p.TraceID] = p
+	return store.flush()
+}
+
+// Update replaces a reversal that is still pending. It reports false, and
+// stores nothing, when the reversal was acknowledged in the meantime.
+func (store *FileStore) Update(p *Pending) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.pending[p.TraceID]; !ok {
+		return false, nil
+	}
+	store.pending[p.TraceID] = p
+	return true, store.flush()
+}
+
+func (store *FileStore) Delete(traceID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.pending[traceID]; !ok {
+		return nil
+	}
+	delete(store.pending, traceID)
+	return store.flush()
+}
+
+func (store *FileStore) Get(traceID string) (*Pending, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	p, ok := store.pending[traceID]
+	return p, ok
+}
+
+// FindByOriginal returns the pending reversal whose F90 equals originalData.
+func (store *FileStore) FindByOriginal(originalData string) (*Pending, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, p := range store.pending {
+		if p.Message.Fields[90] == originalData {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (store *FileStore) List() []*Pending {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	pending := make([]*Pending, 0, len(store.pending))
+	for _, p := range store.pending {
+		pending = append(pending, p)
+	}
+	return pending
+}
+
+func (store *FileStore) flush() error {
+	pending := make([]*Pending, 0, len(store.pending))
+	for _, p := range store.pending {
+		pending = append(pending, p)
+	}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("fail to marshal reversal store: %w", err)
+	}
+	data, err = store.seal(data)
+	if err != nil {
+		return fmt.Errorf("fail to encrypt reversal store: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(store.path), 0o750); err != nil {
+		return fmt.Errorf("fail to create reversal store directory: %w", err)
+	}
+	tmp := store.path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("fail to write reversal store: %w", err)
+	}
+	if err := os.Rename(tmp, store.path); err != nil {
+		return fmt.Errorf("fail to replace reversal store: %w", err)
+	}
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,175 @@
+package reversal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"iso8583-gateway/internal/domain"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const pan = "9704366614952070"
+
+func testKey(t *testing.T) cipher.AEAD {
+	t.Helper()
+	block, err := aes.NewCipher(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+func pending(traceID string) *Pending {
+	return &Pending{
+		TraceID:         traceID,
+		OriginalTraceID: "original-" + traceID,
+		Message: domain.NewISO8583Message("0420", map[int]string{
+			2:   pan,
+			11:  "000123",
+			90:  "0200000123101909301500000970436" + "00000000000",
+			103: "0123456789",
+		}),
+		CreatedAt:  time.Now().UTC(),
+		LastSentAt: time.Now().UTC(),
+	}
+}
+
+func TestStoreSurvivesRestart(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		aead cipher.AEAD
+	}{
+		{"plain", nil},
+		{"sealed", testKey(t)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "reversals.json")
+			store, err := NewFileStore(path, tt.aead)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(pending("trace-1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(pending("trace-2")); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened, err := NewFileStore(path, tt.aead)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(reopened.List()); got != 2 {
+				t.Fatalf("got %d pending reversals after restart, want 2", got)
+			}
+			p, ok := reopened.Get("trace-1")
+			if !ok || p.OriginalTraceID != "original-trace-1" || p.Message.Fields[2] != pan {
+				t.Errorf("reloaded reversal = %+v, want trace-1 with its fields", p)
+			}
+			if _, ok := reopened.FindByOriginal(p.Message.Fields[90]); !ok {
+				t.Errorf("reloaded reversal not found by F90")
+			}
+		})
+	}
+}
+
+func TestSealedStoreHidesCardData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reversals.json")
+	store, err := NewFileStore(path, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(pending("trace-1")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{pan, "0123456789", "trace-1"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("store file contains %s in clear", secret)
+		}
+	}
+	if _, err := NewFileStore(path, nil); err == nil {
+		t.Errorf("sealed store opened without a key")
+	}
+}
+
+// TestUnsealedStoreIsSealedWithKey checks that a store written before a key
+// was set is still read, and sealed on the next change.
+func TestUnsealedStoreIsSealedWithKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reversals.json")
+	plain, err := NewFileStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Save(pending("trace-1")); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := NewFileStore(path, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sealed.Get("trace-1"); !ok {
+		t.Fatal("reversal written without a key is lost")
+	}
+	if err := sealed.Save(pending("trace-2")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(pan)) {
+		t.Errorf("store file still in clear after a change with a key")
+	}
+}
+
+func TestStoreRetryAndRemoval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reversals.json")
+	store, err := NewFileStore(path, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pending("trace-1")
+	if err := store.Save(p); err != nil {
+		t.Fatal(err)
+	}
+
+	retry := *p
+	retry.Attempts = 2
+	retry.LastSentAt = p.LastSentAt.Add(30 * time.Second)
+	if ok, err := store.Update(&retry); !ok || err != nil {
+		t.Fatalf("Update of a pending reversal = %v, %v", ok, err)
+	}
+	reopened, err := NewFileStore(path, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.Get("trace-1"); got.Attempts != 2 || !got.LastSentAt.Equal(retry.LastSentAt) {
+		t.Errorf("reloaded retry = %d attempts at %v, want 2 at %v", got.Attempts, got.LastSentAt, retry.LastSentAt)
+	}
+
+	if err := store.Delete("trace-1"); err != nil {
+		t.Fatal(err)
+	}
+	// A retry racing the acknowledgement must not bring the reversal back.
+	if ok, err := store.Update(&retry); ok || err != nil {
+		t.Errorf("Update after Delete = %v, %v, want false", ok, err)
+	}
+	reopened, err = NewFileStore(path, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(reopened.List()); got != 0 {
+		t.Errorf("got %d pending reversals after removal, want 0", got)
+	}
+}
@@ -0,0 +1,246 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/pkg/metrics"
+	"os"
+	"sync"
+	"time"
+
+	"cel.dev/cel-go/cel"
+	"cel.dev/cel-go/common/types"
+	"cel.dev/cel-go/common/types/ref"
+	"cel.dev/cel-go/common/types/traits"
+	"go.uber.org/zap"
+)
+
+const (
+	ActionRoute  = "route"
+	ActionTag    = "tag"
+	ActionReject = "reject"
+	ActionDrop   = "drop"
+)
+
+// Rule is one entry of the rules file. Expression is a CEL expression over
+// mti (string) and fields (map of field number to value); fields.get(n)
+// returns "" for an absent field.
+type Rule struct {
+	Name         string `json:"name"`
+	Expression   string `json:"expression"`
+	Action       string `json:"action"`
+	Topic        string `json:"topic,omitempty"`
+	Tag          string `json:"tag,omitempty"`
+	ResponseCode string `json:"response_code,omitempty"`
+	DryRun       bool   `json:"dry_run,omitempty"`
+
+	program cel.Program
+}
+
+type file struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// Decision is the outcome of the rules for one message: the tags of every
+// matching tag rule, and the first matching route, reject or drop rule, if
+// any.
+type Decision struct {
+	Rule         string
+	Action       string
+	Topic        string
+	ResponseCode string
+	Tags         []string
+}
+
+// Engine evaluates the rules of a file in order and reloads them when the
+// file changes. A file that fails to load keeps the previous rules in force.
+type Engine struct {
+	cfg     *config.RulesConfig
+	env     *cel.Env
+	mu      sync.RWMutex
+	rules   []*Rule
+	modTime time.Time
+}
+
+// Load compiles the rules file. Without a file the engine has no rules.
+func Load(cfg *config.RulesConfig) (*Engine, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+	engine := &Engine{cfg: cfg, env: env}
+	if cfg.File == "" {
+		return engine, nil
+	}
+	if err := engine.reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+func newEnv() (*cel.Env, error) {
+	fieldsType := cel.MapType(cel.IntType, cel.StringType)
+	return cel.NewEnv(
+		cel.Variable("mti", cel.StringType),
+		cel.Variable("fields", fieldsType),
+		cel.Function("get",
+			cel.MemberOverload("fields_get_int", []*cel.Type{fieldsType, cel.IntType}, cel.StringType,
+				cel.BinaryBinding(func(fields ref.Val, n ref.Val) ref.Val {
+					if v, ok := fields.(traits.Mapper).Find(n); ok {
+						return v
+					}
+					return types.String("")
+				}),
+			),
+		),
+	)
+}
+
+func (engine *Engine) reload() error {
+	info, err := os.Stat(engine.cfg.File)
+	if err != nil {
+		return fmt.Errorf("stat rules file: %w", err)
+	}
+	data, err := os.ReadFile(engine.cfg.File)
+	if err != nil {
+		return fmt.Errorf("read rules file: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parse rules file %s: %w", engine.cfg.File, err)
+	}
+	names := make(map[string]bool, len(f.Rules))
+	for _, rule := range f.Rules {
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if err := engine.compile(rule); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+	}
+	engine.mu.Lock()
+	engine.rules = f.Rules
+	engine.modTime = info.ModTime()
+	engine.mu.Unlock()
+	zap.L().Info("Loaded rules", zap.String("file", engine.cfg.File), zap.Int("rules", len(f.Rules)), zap.Bool("dry_run", engine.cfg.DryRun))
+	return nil
+}
+
+func (engine *Engine) compile(rule *Rule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	switch rule.Action {
+	case ActionRoute:
+		if rule.Topic == "" {
+			return errors.New("route action requires a topic")
+		}
+	case ActionTag:
+		if rule.Tag == "" {
+			return errors.New("tag action requires a tag")
+		}
+	case ActionReject:
+		if len(rule.ResponseCode) != 2 {
+			return fmt.Errorf("reject action requires a 2 character response_code, got %q", rule.ResponseCode)
+		}
+	case ActionDrop:
+	default:
+		return fmt.Errorf("unknown action %q, expected route, tag, reject or drop", rule.Action)
+	}
+	ast, issues := engine.env.Compile(rule.Expression)
+	if issues != nil && issues.Err() != nil {
+		return issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return fmt.Errorf("expression must be a bool, got %s", ast.OutputType())
+	}
+	program, err := engine.env.Program(ast)
+	if err != nil {
+		return err
+	}
+	rule.program = program
+	return nil
+}
+
+// Evaluate runs the rules against a message. Rules in dry-run, or every rule
+// when the engine is in dry-run mode, are only logged and counted.
+func (engine *Engine) Evaluate(msg *domain.ISO8583Message) Decision {
+	engine.mu.RLock()
+	rules := engine.rules
+	engine.mu.RUnlock()
+
+	var decision Decision
+	if len(rules) == 0 {
+		return decision
+	}
+	fields := make(map[int64]string, len(msg.Fields))
+	for i, f := range msg.Fields {
+		fields[int64(i)] = f
+	}
+	vars := map[string]any{"mti": msg.MTI, "fields": fields}
+	for _, rule := range rules {
+		out, _, err := rule.program.Eval(vars)
+		if err != nil {
+			zap.L().Debug("Rule did not evaluate", zap.String("rule", rule.Name), zap.Error(err), zap.String("f63", msg.Fields[63]))
+			continue
+		}
+		if out != types.True {
+			continue
+		}
+		if engine.cfg.DryRun || rule.DryRun {
+			metrics.RuleMatches.WithLabelValues(rule.Name, rule.Action, metrics.RuleModeDryRun).Inc()
+			zap.L().Info("Rule would fire", zap.String("rule", rule.Name), zap.String("action", rule.Action), zap.String("mti", msg.MTI), zap.String("f63", msg.Fields[63]))
+			continue
+		}
+		metrics.RuleMatches.WithLabelValues(rule.Name, rule.Action, metrics.RuleModeApplied).Inc()
+		zap.L().Info("Rule fired", zap.String("rule", rule.Name), zap.String("action", rule.Action), zap.String("mti", msg.MTI), zap.String("f63", msg.Fields[63]))
+		if rule.Action == ActionTag {
+			decision.Tags = append(decision.Tags, rule.Tag)
+			continue
+		}
+		decision.Rule = rule.Name
+		decision.Action = rule.Action
+		decision.Topic = rule.Topic
+		decision.ResponseCode = rule.ResponseCode
+		break
+	}
+	return decision
+}
+
+// Run reloads the rules file whenever its modification time changes.
+func (engine *Engine) Run(ctx context.Context) {
+	if engine.cfg.File == "" {
+		return
+	}
+	ticker := time.NewTicker(engine.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(engine.cfg.File)
+			if err != nil {
+				zap.L().Error("Fail to stat rules file", zap.String("file", engine.cfg.File), zap.Error(err))
+				continue
+			}
+			engine.mu.RLock()
+			changed := !info.ModTime().Equal(engine.modTime)
+			engine.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := engine.reload(); err != nil {
+				zap.L().Error("Fail to reload rules, keeping previous rules", zap.String("file", engine.cfg.File), zap.Error(err))
+				engine.mu.Lock()
+				engine.modTime = info.ModTime()
+				engine.mu.Unlock()
+			}
+		}
+	}
+}
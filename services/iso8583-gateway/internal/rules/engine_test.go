@@ -0,0 +1,206 @@
+package rules
+
+import (
+	"context"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/pkg/metrics"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func writeRules(t *testing.T, path string, rules string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(`{"rules": [`+rules+`]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func load(t *testing.T, rules string, dryRun bool) *Engine {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRules(t, path, rules)
+	engine, err := Load(&config.RulesConfig{File: path, ReloadInterval: 10 * time.Millisecond, DryRun: dryRun})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return engine
+}
+
+func message(mti string, fields map[int]string) *domain.ISO8583Message {
+	return &domain.ISO8583Message{MTI: mti, Fields: fields}
+}
+
+func TestEvaluateActions(t *testing.T) {
+	engine := load(t, `
+		{"name": "drop-test-terminal", "expression": "fields.get(41) == 'TEST0001'", "action": "drop"},
+		{"name": "block-terminal", "expression": "fields.get(41) == 'ATM00042'", "action": "reject", "response_code": "57"},
+		{"name": "manual-review", "expression": "mti == '0200' && int(fields.get(4)) > 50000000000", "action": "route", "topic": "transfer.manual.review"},
+		{"name": "tag-bin", "expression": "fields.get(2).startsWith('970436')", "action": "tag", "tag": "bin-970436"}`, false)
+
+	tests := []struct {
+		name string
+		msg  *domain.ISO8583Message
+		want Decision
+	}{
+		{"drop", message("0200", map[int]string{41: "TEST0001"}), Decision{Rule: "drop-test-terminal", Action: ActionDrop}},
+		{"reject", message("0200", map[int]string{41: "ATM00042"}), Decision{Rule: "block-terminal", Action: ActionReject, ResponseCode: "57"}},
+		{"route", message("0200", map[int]string{4: "60000000000"}), Decision{Rule: "manual-review", Action: ActionRoute, Topic: "transfer.manual.review"}},
+		{"tag", message("0200", map[int]string{2: "9704361234567890", 4: "100"}), Decision{Tags: []string{"bin-970436"}}},
+		{"no match", message("0800", map[int]string{70: "301"}), Decision{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := engine.Evaluate(tt.msg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateFirstMatchWins(t *testing.T) {
+	engine := load(t, `
+		{"name": "first", "expression": "mti == '0200'", "action": "route", "topic": "first"},
+		{"name": "second", "expression": "mti == '0200'", "action": "reject", "response_code": "05"}`, false)
+
+	got := engine.Evaluate(message("0200", nil))
+	if got.Rule != "first" || got.Topic != "first" || got.ResponseCode != "" {
+		t.Errorf("Evaluate = %+v, want the first rule only", got)
+	}
+}
+
+// TestEvaluateTagsAccumulate checks that every matching tag rule before the
+// deciding rule adds its tag, and that tag rules after it are not reached.
+func TestEvaluateTagsAccumulate(t *testing.T) {
+	engine := load(t, `
+		{"name": "tag-a", "expression": "true", "action": "tag", "tag": "a"},
+		{"name": "tag-b", "expression": "mti == '0200'", "action": "tag", "tag": "b"},
+		{"name": "tag-c", "expression": "mti == '0800'", "action": "tag", "tag": "c"},
+		{"name": "route", "expression": "true", "action": "route", "topic": "tagged"},
+		{"name": "tag-d", "expression": "true", "action": "tag", "tag": "d"}`, false)
+
+	got := engine.Evaluate(message("0200", nil))
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got.Tags, want) {
+		t.Errorf("Tags = %v, want %v", got.Tags, want)
+	}
+	if got.Rule != "route" {
+		t.Errorf("Rule = %q, want route", got.Rule)
+	}
+}
+
+func TestEvaluateDryRun(t *testing.T) {
+	rules := `
+		{"name": "dry-reject", "expression": "mti == '0200'", "action": "reject", "response_code": "57", "dry_run": true},
+		{"name": "dry-tag", "expression": "true", "action": "tag", "tag": "dry", "dry_run": true},
+		{"name": "route", "expression": "true", "action": "route", "topic": "live"}`
+
+	t.Run("per rule", func(t *testing.T) {
+		engine := load(t, rules, false)
+		before := testutil.ToFloat64(metrics.RuleMatches.WithLabelValues("dry-reject", ActionReject, metrics.RuleModeDryRun))
+
+		got := engine.Evaluate(message("0200", nil))
+		if want := (Decision{Rule: "route", Action: ActionRoute, Topic: "live"}); !reflect.DeepEqual(got, want) {
+			t.Errorf("Evaluate = %+v, want %+v", got, want)
+		}
+		if after := testutil.ToFloat64(metrics.RuleMatches.WithLabelValues("dry-reject", ActionReject, metrics.RuleModeDryRun)); after != before+1 {
+			t.Errorf("dry-run matches = %v, want %v", after, before+1)
+		}
+	})
+	t.Run("global", func(t *testing.T) {
+		engine := load(t, rules, true)
+		if got := engine.Evaluate(message("0200", nil)); !reflect.DeepEqual(got, Decision{}) {
+			t.Errorf("Evaluate = %+v, want no decision in dry-run", got)
+		}
+	})
+}
+
+func TestLoadRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"non-bool expression", `{"name": "amount", "expression": "fields.get(4)", "action": "drop"}`, "must be a bool"},
+		{"duplicate name", `{"name": "twice", "expression": "true", "action": "drop"}, {"name": "twice", "expression": "false", "action": "drop"}`, "duplicate rule name"},
+		{"unknown action", `{"name": "hold", "expression": "true", "action": "hold"}`, "unknown action"},
+		{"route without topic", `{"name": "route", "expression": "true", "action": "route"}`, "requires a topic"},
+		{"reject without response code", `{"name": "reject", "expression": "true", "action": "reject"}`, "response_code"},
+		{"syntax error", `{"name": "broken", "expression": "mti ==", "action": "drop"}`, "broken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			writeRules(t, path, tt.rules)
+			_, err := Load(&config.RulesConfig{File: path, ReloadInterval: time.Second})
+			if err == nil {
+				t.Fatal("Load accepted invalid rules")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q doesn't mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// reloaded waits until Run has looked at the file modified at modTime.
+func reloaded(t *testing.T, engine *Engine, modTime time.Time) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		engine.mu.RLock()
+		seen := engine.modTime.Equal(modTime)
+		engine.mu.RUnlock()
+		if seen {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("rules file was not reloaded")
+}
+
+func touch(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunReloadsChangedFile(t *testing.T) {
+	engine := load(t, `{"name": "old", "expression": "true", "action": "drop"}`, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Run(ctx)
+
+	writeRules(t, engine.cfg.File, `{"name": "new", "expression": "true", "action": "route", "topic": "new"}`)
+	modTime := time.Now().Add(time.Minute).Truncate(time.Second)
+	touch(t, engine.cfg.File, modTime)
+	reloaded(t, engine, modTime)
+
+	if got := engine.Evaluate(message("0200", nil)); got.Rule != "new" {
+		t.Errorf("Rule = %q after reload, want new", got.Rule)
+	}
+}
+
+func TestRunKeepsRulesWhenReloadFails(t *testing.T) {
+	engine := load(t, `{"name": "old", "expression": "true", "action": "drop"}`, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Run(ctx)
+
+	if err := os.WriteFile(engine.cfg.File, []byte(`{"rules": [{"name": "new", "expression": "mti ==", "action": "drop"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute).Truncate(time.Second)
+	touch(t, engine.cfg.File, modTime)
+	reloaded(t, engine, modTime)
+
+	if got := engine.Evaluate(message("0200", nil)); got.Rule != "old" {
+		t.Errorf("Rule = %q after a broken reload, want old", got.Rule)
+	}
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/handler"
+	"iso8583-gateway/internal/profile"
+	"iso8583-gateway/internal/service"
+	"iso8583-gateway/internal/session"
+	"iso8583-gateway/pkg/metrics"
+	"iso8583-gateway/pkg/util"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	refusalPeerNotAllowed = "peer_not_allowed"
+	refusalIPSessionLimit = "ip_session_limit"
+)
+
+// handshakeTimeout bounds the TLS handshake of an accepted connection.
+const handshakeTimeout = 10 * time.Second
+
+// Listener accepts partner connections on one port, with its own TLS,
+// framing, profile, access control, routes and rate limit. Listeners are
+// started and stopped independently; stopping one closes its sessions.
+type Listener struct {
+	server    *Server
+	cfg       *config.ListenerConfig
+	profile   *profile.Profile
+	tlsConfig *tls.Config
+	allowed   []netip.Prefix
+	acquirers []peerAcquirer
+	policy    *service.ListenerPolicy
+	mu        sync.Mutex
+	ln        net.Listener
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	peersMu   sync.Mutex
+	peers     map[netip.Addr]int
+}
+
+type peerAcquirer struct {
+	prefix   netip.Prefix
+	acquirer string
+}
+
+func newListener(server *Server, cfg *config.ListenerConfig) (*Listener, error) {
+	p, ok := server.profiles.Get(cfg.Profile)
+	if !ok {
+		return nil, fmt.Errorf("unknown spec profile %q, expected one of %v", cfg.Profile, server.profiles.Names())
+	}
+	listener := &Listener{
+		server:  server,
+		cfg:     cfg,
+		profile: p,
+		policy:  service.NewListenerPolicy(cfg),
+		peers:   make(map[netip.Addr]int),
+	}
+	for _, peer := range cfg.AllowedPeers {
+		prefix, err := util.ParsePrefix(peer)
+		if err != nil {
+			return nil, fmt.Errorf("allowed peer %w", err)
+		}
+		listener.allowed = append(listener.allowed, prefix)
+	}
+	for _, acquirer := range cfg.Acquirers {
+		prefix, err := util.ParsePrefix(acquirer.Peer)
+		if err != nil {
+			return nil, fmt.Errorf("acquirer peer %w", err)
+		}
+		listener.acquirers = append(listener.acquirers, peerAcquirer{prefix: prefix, acquirer: acquirer.Acquirer})
+	}
+	if cfg.TLS != nil {
+		tlsConfig, err := newTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		listener.tlsConfig = tlsConfig
+	}
+	return listener, nil
+}
+
+func newTLSConfig(cfg *config.ListenerTLS) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load listener certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if cfg.ClientCAFile != "" {
+		ca, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("client CA file %s contains no PEM certificate", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+func (listener *Listener) Name() string {
+	return listener.cfg.Name
+}
+
+func (listener *Listener) Config() *config.ListenerConfig {
+	return listener.cfg
+}
+
+// Running reports whether the listener is accepting connections.
+func (listener *Listener) Running() bool {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	return listener.ln != nil
+}
+
+// Start opens the port and accepts connections until Stop.
+func (listener *Listener) Start() error {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	if listener.ln != nil {
+		return errors.New("listener is already running")
+	}
+	address := listener.cfg.Address()
+	zap.L().Info("Starting listener", zap.String("listener", listener.Name()), zap.String("address", address))
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	if listener.tlsConfig != nil {
+		ln = tls.NewListener(ln, listener.tlsConfig)
+	}
+	ctx, cancel := context.WithCancel(listener.server.ctx)
+	listener.ln = ln
+	listener.cancel = cancel
+	metrics.ListenerUp.WithLabelValues(listener.Name()).Set(1)
+	zap.L().Info("Listener started", zap.String("listener", listener.Name()), zap.String("address", address), zap.String("profile", listener.profile.Name), zap.String("framing", listener.cfg.Framing), zap.Bool("tls", listener.tlsConfig != nil))
+	go listener.acceptConnection(ctx, ln)
+	return nil
+}
+
+// Stop closes the port and the sessions accepted on it, and waits for them
+// to finish.
+func (listener *Listener) Stop() {
+	listener.mu.Lock()
+	ln, cancel := listener.ln, listener.cancel
+	listener.ln, listener.cancel = nil, nil
+	listener.mu.Unlock()
+	if ln == nil {
+		return
+	}
+	zap.L().Info("Stopping listener", zap.String("listener", listener.Name()))
+	cancel()
+	if err := ln.Close(); err != nil {
+		zap.L().Error("Failed to close listener", zap.String("listener", listener.Name()), zap.Error(err))
+	}
+	listener.wg.Wait()
+	metrics.ListenerUp.WithLabelValues(listener.Name()).Set(0)
+	zap.L().Info("Listener stopped", zap.String("listener", listener.Name()))
+}
+
+func (listener *Listener) acceptConnection(ctx context.Context, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				zap.L().Error("Failed to accept connection", zap.String("listener", listener.Name()), zap.Error(err))
+				continue
+			}
+		}
+		remoteAddr := conn.RemoteAddr().String()
+		addr, _ := util.RemoteIP(remoteAddr)
+		if !listener.allows(addr) {
+			listener.refuse(conn, refusalPeerNotAllowed)
+			continue
+		}
+		if !listener.acquirePeer(addr) {
+			listener.refuse(conn, refusalIPSessionLimit, zap.Int("max_sessions", listener.cfg.MaxSessionsPerIP))
+			continue
+		}
+		listener.wg.Add(1)
+		go func() {
+			defer listener.wg.Done()
+			defer listener.releasePeer(addr)
+			listener.serve(ctx, conn, addr)
+		}()
+	}
+}
+
+// serve completes the TLS handshake, if any, and reads the connection until
+// it closes. The handshake runs here rather than lazily on the first read so
+// that a client that never completes it is closed after handshakeTimeout
+// without a session, and does not hold up the accept loop.
+func (listener *Listener) serve(ctx context.Context, conn net.Conn, addr netip.Addr) {
+	server := listener.server
+	remoteAddr := conn.RemoteAddr().String()
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := handshake(ctx, tlsConn, handshakeTimeout); err != nil {
+			zap.L().Warn("Fail to complete TLS handshake", zap.String("listener", listener.Name()), zap.String("remote_addr", remoteAddr), zap.Error(err))
+			closeConnection(conn)
+			return
+		}
+	}
+	selection := server.profiles.Select(listener.profile, remoteAddr)
+	zap.L().Info("New connection accepted", zap.String("listener", listener.Name()), zap.String("remote_addr", remoteAddr), zap.String("profile", selection.Profile().Name))
+	framing := handler.Framing(listener.cfg.Framing)
+	s := session.NewSession(conn, selection, framing)
+	if acquirer, ok := listener.acquirerOf(addr); ok {
+		s.BindAcquirer(acquirer)
+	}
+	server.sessions.Add(s)
+	inboundChan := make(chan *domain.ISO8583Message, 200)
+	reader := handler.NewISO8583Reader(conn, ctx, inboundChan, selection, framing)
+	inboundService := service.NewInboundService(ctx, inboundChan, server.cfg, server.publisher, s, server.sessions, server.directory, server.correlations, server.dedupes, server.journal, server.rules, server.serializer, server.validator, listener.policy, server.institutions)
+	go inboundService.ProcessInbound()
+	reader.Read()
+	for _, institution := range server.sessions.Remove(s) {
+		server.directory.Withdraw(institution)
+	}
+}
+
+// handshake runs the server side of the TLS handshake, giving up after
+// timeout or when the listener stops.
+func handshake(ctx context.Context, conn *tls.Conn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return conn.HandshakeContext(ctx)
+}
+
+// allows reports whether the peer is in the allowed peers, if any.
+func (listener *Listener) allows(addr netip.Addr) bool {
+	if len(listener.allowed) == 0 {
+		return true
+	}
+	if !addr.IsValid() {
+		return false
+	}
+	for _, prefix := range listener.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// acquirePeer counts one more session from addr, unless it already holds
+// the maximum.
+func (listener *Listener) acquirePeer(addr netip.Addr) bool {
+	listener.peersMu.Lock()
+	defer listener.peersMu.Unlock()
+	if limit := listener.cfg.MaxSessionsPerIP; limit > 0 && listener.peers[addr] >= limit {
+		return false
+	}
+	listener.peers[addr]++
+	return true
+}
+
+func (listener *Listener) releasePeer(addr netip.Addr) {
+	listener.peersMu.Lock()
+	defer listener.peersMu.Unlock()
+	if listener.peers[addr] <= 1 {
+		delete(listener.peers, addr)
+		return
+	}
+	listener.peers[addr]--
+}
+
+// acquirerOf returns the acquirer ID the sessions of addr are bound to.
+func (listener *Listener) acquirerOf(addr netip.Addr) (string, bool) {
+	for _, acquirer := range listener.acquirers {
+		if addr.IsValid() && acquirer.prefix.Contains(addr) {
+			return acquirer.acquirer, true
+		}
+	}
+	return "", false
+}
+
+func (listener *Listener) refuse(conn net.Conn, reason string, fields ...zap.Field) {
+	metrics.AccessRefusals.WithLabelValues(listener.Name(), reason).Inc()
+	zap.L().Warn("Refuse connection by access control", append([]zap.Field{zap.String("listener", listener.Name()), zap.String("reason", reason), zap.String("remote_addr", conn.RemoteAddr().String())}, fields...)...)
+	closeConnection(conn)
+}
+
+func closeConnection(conn net.Conn) {
+	if err := conn.Close(); err != nil {
+		zap.L().Error("Failed to close connection", zap.String("remote_addr", conn.RemoteAddr().String()), zap.Error(err))
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/profile"
+	"iso8583-gateway/pkg/util"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func serverTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), DNSNames: []string{"gateway"}}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestHandshake(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	client := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+	go client.Handshake()
+
+	if err := handshake(context.Background(), tls.Server(serverConn, serverTLSConfig(t)), time.Second); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+}
+
+// TestHandshakeTimeout checks that a client that never starts the handshake
+// is given up on after the timeout rather than waited on.
+func TestHandshakeTimeout(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	start := time.Now()
+	err := handshake(context.Background(), tls.Server(serverConn, serverTLSConfig(t)), 50*time.Millisecond)
+	if err == nil {
+		t.Fatal("handshake succeeded without a client")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("handshake gave up after %v, want about 50ms", elapsed)
+	}
+}
+
+func TestHandshakeCanceled(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := handshake(ctx, tls.Server(serverConn, serverTLSConfig(t)), time.Minute); err == nil {
+		t.Fatal("handshake succeeded after the listener stopped")
+	}
+}
+
+func newTestListener(t *testing.T, cfg *config.ListenerConfig) *Listener {
+	t.Helper()
+	profiles, err := profile.Load(&config.ProfileConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Profile = profile.Default
+	listener, err := newListener(&Server{profiles: profiles}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func TestListenerAllows(t *testing.T) {
+	restricted := newTestListener(t, &config.ListenerConfig{Name: "atm", AllowedPeers: []string{"10.0.0.0/24", "192.168.1.7", "2001:db8:1::/48"}})
+	open := newTestListener(t, &config.ListenerConfig{Name: "open"})
+	tests := []struct {
+		name       string
+		listener   *Listener
+		remoteAddr string
+		want       bool
+	}{
+		{"in CIDR block", restricted, "10.0.0.12:40522", true},
+		{"outside CIDR block", restricted, "10.0.1.12:40522", false},
+		{"single address", restricted, "192.168.1.7:40522", true},
+		{"next to single address", restricted, "192.168.1.8:40522", false},
+		{"IPv6 in block", restricted, "[2001:db8:1:2::5]:40522", true},
+		{"IPv6 outside block", restricted, "[2001:db8:2::5]:40522", false},
+		{"IPv4-mapped IPv6", restricted, "[::ffff:10.0.0.12]:40522", true},
+		{"malformed address", restricted, "10.0.0.12", false},
+		{"no allowed peers", open, "203.0.113.9:40522", true},
+		{"no allowed peers, malformed address", open, "not an address", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := util.RemoteIP(tt.remoteAddr)
+			if got := tt.listener.allows(addr); got != tt.want {
+				t.Errorf("allows(%s) = %v, want %v", tt.remoteAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListenerPeerSessionLimit(t *testing.T) {
+	listener := newTestListener(t, &config.ListenerConfig{Name: "atm", MaxSessionsPerIP: 2})
+	peer, _ := util.RemoteIP("10.0.0.12:40522")
+	other, _ := util.RemoteIP("10.0.0.13:40522")
+
+	for i := range 2 {
+		if !listener.acquirePeer(peer) {
+			t.Fatalf("session %d of %s refused within the limit", i+1, peer)
+		}
+	}
+	if listener.acquirePeer(peer) {
+		t.Fatalf("third session of %s accepted over the limit", peer)
+	}
+	if !listener.acquirePeer(other) {
+		t.Fatalf("session of %s refused for the sessions of %s", other, peer)
+	}
+
+	// Closing a session frees its slot; closing them all forgets the peer.
+	listener.releasePeer(peer)
+	if !listener.acquirePeer(peer) {
+		t.Fatal("session refused after one was closed")
+	}
+	listener.releasePeer(peer)
+	listener.releasePeer(peer)
+	if _, ok := listener.peers[peer]; ok {
+		t.Errorf("peer still counted after its sessions closed: %d", listener.peers[peer])
+	}
+}
+
+func TestListenerPeerSessionsUnlimited(t *testing.T) {
+	listener := newTestListener(t, &config.ListenerConfig{Name: "atm"})
+	peer, _ := util.RemoteIP("10.0.0.12:40522")
+	for i := range 100 {
+		if !listener.acquirePeer(peer) {
+			t.Fatalf("session %d refused without a limit", i+1)
+		}
+	}
+}
+
+func TestListenerAcquirerOf(t *testing.T) {
+	listener := newTestListener(t, &config.ListenerConfig{Name: "atm", Acquirers: []config.PeerAcquirer{
+		{Peer: "10.0.0.0/24", Acquirer: "970436"},
+		{Peer: "10.0.1.5", Acquirer: "970415"},
+		{Peer: "2001:db8:1::/48", Acquirer: "970422"},
+	}})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+		wantOK     bool
+	}{
+		{"CIDR block", "10.0.0.12:40522", "970436", true},
+		{"single address", "10.0.1.5:40522", "970415", true},
+		{"IPv6 block", "[2001:db8:1::9]:40522", "970422", true},
+		{"unbound peer", "10.0.2.1:40522", "", false},
+		{"malformed address", "10.0.0.12", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := util.RemoteIP(tt.remoteAddr)
+			got, ok := listener.acquirerOf(addr)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("acquirerOf(%s) = %q, %v, want %q, %v", tt.remoteAddr, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
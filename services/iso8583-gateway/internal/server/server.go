@@ -4,83 +4,162 @@ import (
 	"context"
 	"fmt"
 	"iso8583-gateway/internal/config"
-	"iso8583-gateway/internal/domain"
-	"iso8583-gateway/internal/handler"
+	"iso8583-gateway/internal/correlation"
+	"iso8583-gateway/internal/dedupe"
+	"iso8583-gateway/internal/journal"
+	"iso8583-gateway/internal/profile"
+	"iso8583-gateway/internal/publisher"
+	"iso8583-gateway/internal/reversal"
+	"iso8583-gateway/internal/rules"
 	"iso8583-gateway/internal/service"
-	"net"
+	"iso8583-gateway/internal/session"
+	"iso8583-gateway/internal/validation"
+	"iso8583-gateway/pkg/contract"
 	"sync"
 
-	"github.com/IBM/sarama"
 	"go.uber.org/zap"
 )
 
+// Server is the part of the gateway its listeners share: the sessions, the
+// pending requests and the services reading from Kafka.
 type Server struct {
-	address    string
-	listener   net.Listener
-	ctx        context.Context
-	cancelFunc context.CancelFunc
-	wg         sync.WaitGroup
-	cfg        *config.ApplicationConfig
-	producer   sarama.SyncProducer
+	ctx          context.Context
+	cancelFunc   context.CancelFunc
+	wg           sync.WaitGroup
+	cfg          *config.ApplicationConfig
+	publisher    publisher.Publisher
+	sessions     *session.Registry
+	directory    *service.SessionDirectory
+	correlations *correlation.Store
+	dedupes      *dedupe.Store
+	journal      *journal.Journal
+	rules        *rules.Engine
+	serializer   contract.Serializer
+	validator    *validation.Validator
+	profiles     *profile.Registry
+	reversals    *service.ReversalService
+	responses    *service.ResponseService
+	institutions *service.Institutions
+	mu           sync.RWMutex
+	listeners    map[string]*Listener
+	order        []string
 }
 
-func NewServer(host string, port string, cfg *config.ApplicationConfig, producer sarama.SyncProducer) *Server {
-	address := fmt.Sprintf("%s:%s", host, port)
+func NewServer(cfg *config.ApplicationConfig, publisher publisher.Publisher, subscriber publisher.Subscriber, reversalStore *reversal.FileStore, j *journal.Journal, engine *rules.Engine, serializer contract.Serializer, validator *validation.Validator, profiles *profile.Registry) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
+	sessions := session.NewRegistry()
+	directory := service.NewSessionDirectory(ctx, cfg, publisher, subscriber)
+	correlations := correlation.NewStore(cfg.CorrelationRetention)
+	dedupes := dedupe.NewStore(cfg.DedupeWindow)
+	reversals := service.NewReversalService(ctx, cfg, publisher, reversalStore, j, serializer)
+	institutions := service.NewInstitutions(append(cfg.Institutions(), profiles.Institutions()...)...)
 	return &Server{
-		address:    address,
-		ctx:        ctx,
-		cancelFunc: cancel,
-		cfg:        cfg,
-		producer:   producer,
+		ctx:          ctx,
+		cancelFunc:   cancel,
+		cfg:          cfg,
+		publisher:    publisher,
+		sessions:     sessions,
+		directory:    directory,
+		correlations: correlations,
+		dedupes:      dedupes,
+		journal:      j,
+		rules:        engine,
+		serializer:   serializer,
+		validator:    validator,
+		profiles:     profiles,
+		reversals:    reversals,
+		responses:    service.NewResponseService(ctx, cfg, publisher, subscriber, sessions, directory, correlations, reversals, dedupes, j, institutions),
+		institutions: institutions,
+		listeners:    make(map[string]*Listener),
 	}
 }
 
-func (server *Server) Start() {
-	zap.L().Info("Starting server", zap.String("address", server.address))
-	ln, err := net.Listen("tcp", server.address)
+// AddListener registers a listener. It is started with the server unless it
+// is configured stopped.
+func (server *Server) AddListener(cfg *config.ListenerConfig) error {
+	listener, err := newListener(server, cfg)
 	if err != nil {
-		zap.L().Fatal("Failed to start server", zap.Error(err))
+		return fmt.Errorf("listener %q: %w", cfg.Name, err)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, ok := server.listeners[cfg.Name]; ok {
+		return fmt.Errorf("duplicate listener %q", cfg.Name)
+	}
+	server.listeners[cfg.Name] = listener
+	server.institutions.Add(cfg.Institutions()...)
+	server.order = append(server.order, cfg.Name)
+	return nil
+}
+
+// Listener returns the listener with the given name.
+func (server *Server) Listener(name string) (*Listener, bool) {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	listener, ok := server.listeners[name]
+	return listener, ok
+}
+
+// Listeners returns the listeners in the order they were added.
+func (server *Server) Listeners() []*Listener {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	listeners := make([]*Listener, 0, len(server.order))
+	for _, name := range server.order {
+		listeners = append(listeners, server.listeners[name])
 	}
-	server.listener = ln
-	zap.L().Info("Server started", zap.String("address", server.address))
-	go server.acceptConnection()
+	return listeners
 }
 
-func (server *Server) acceptConnection() {
-	zap.L().Info("Accepting connection", zap.String("address", server.address))
-	for {
-		conn, err := server.listener.Accept()
-		if err != nil {
-			select {
-			case <-server.ctx.Done():
-				return
-			default:
-				zap.L().Error("Failed to accept connection", zap.Error(err))
-				continue
-			}
+func (server *Server) Start() {
+	zap.L().Info("Starting server")
+	server.wg.Add(7)
+	go func() {
+		defer server.wg.Done()
+		server.directory.ProcessDirectory()
+	}()
+	go func() {
+		defer server.wg.Done()
+		server.responses.ProcessResponse()
+	}()
+	go func() {
+		defer server.wg.Done()
+		server.correlations.Run(server.ctx, server.responses.ProcessTimeout)
+	}()
+	go func() {
+		defer server.wg.Done()
+		server.reversals.ProcessReversal()
+	}()
+	go func() {
+		defer server.wg.Done()
+		server.dedupes.Run(server.ctx)
+	}()
+	go func() {
+		defer server.wg.Done()
+		server.journal.Run(server.ctx)
+	}()
+	go func() {
+		defer server.wg.Done()
+		server.rules.Run(server.ctx)
+	}()
+	for _, listener := range server.Listeners() {
+		if listener.cfg.Stopped {
+			zap.L().Info("Listener left stopped", zap.String("listener", listener.Name()))
+			continue
+		}
+		if err := listener.Start(); err != nil {
+			zap.L().Fatal("Failed to start listener", zap.String("listener", listener.Name()), zap.Error(err))
 		}
-		zap.L().Info("New connection accepted", zap.String("remote_addr", conn.RemoteAddr().String()))
-		inboundChan := make(chan *domain.ISO8583Message, 200)
-		reader := handler.NewISO8583Reader(conn, server.ctx, inboundChan)
-		inboundService := service.NewInboundService(server.ctx, inboundChan, server.cfg, server.producer)
-		server.wg.Add(1)
-		go func() {
-			defer server.wg.Done()
-			reader.Read()
-		}()
-		go inboundService.ProcessInbound()
 	}
+	zap.L().Info("Server started")
 }
 
 func (server *Server) Shutdown() {
 	zap.L().Info("Shutting down server")
-	server.cancelFunc()
-	if server.listener != nil {
-		if err := server.listener.Close(); err != nil {
-			zap.L().Error("Failed to close server listener", zap.Error(err))
-		}
+	for _, listener := range server.Listeners() {
+		listener.Stop()
 	}
+	server.cancelFunc()
 	server.wg.Wait()
 	zap.L().Info("Server shutdown completed")
 }
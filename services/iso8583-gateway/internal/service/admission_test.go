@@ -0,0 +1,122 @@
+package service
+
+import (
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/handler"
+	"iso8583-gateway/internal/session"
+	"net"
+	"testing"
+	"time"
+)
+
+// admit calls InboundService.admit on msg in the background. A refused request is answered
+// on the pipe, so admit only returns once the answer is read.
+func admit(h *harness, msg *domain.ISO8583Message) <-chan bool {
+	result := make(chan bool, 1)
+	go func() { result <- h.inbound.admit(msg, msg.Fields[63]) }()
+	return result
+}
+
+func admitResult(h *harness, result <-chan bool) bool {
+	h.t.Helper()
+	select {
+	case ok := <-result:
+		return ok
+	case <-time.After(2 * time.Second):
+		h.t.Fatal("admit did not return")
+		return false
+	}
+}
+
+func expectAdmitted(h *harness, msg *domain.ISO8583Message) {
+	h.t.Helper()
+	if !admitResult(h, admit(h, msg)) {
+		h.t.Fatalf("%s of %s refused", msg.MTI, msg.Fields[32])
+	}
+}
+
+// expectRefused checks that msg is refused and answered with 58.
+func expectRefused(h *harness, msg *domain.ISO8583Message) {
+	h.t.Helper()
+	result := admit(h, msg)
+	answer := h.receive()
+	if admitResult(h, result) {
+		h.t.Fatalf("%s of %s admitted", msg.MTI, msg.Fields[32])
+	}
+	if answer.MTI != "0210" || answer.Fields[39] != responseCodeNotAllowed || answer.Fields[63] != msg.Fields[63] {
+		h.t.Errorf("refusal answer %s F39 %q F63 %q, want 0210 with RC %s", answer.MTI, answer.Fields[39], answer.Fields[63], responseCodeNotAllowed)
+	}
+}
+
+func echoTest(traceID string) *domain.ISO8583Message {
+	return domain.NewISO8583Message("0800", map[int]string{7: "1019093015", 11: "000001", 63: traceID, 70: "301"})
+}
+
+func TestAdmitAcquirer(t *testing.T) {
+	withF32 := func(acquirer string) *domain.ISO8583Message {
+		msg := transfer("trace-1", "000001")
+		if acquirer == "" {
+			delete(msg.Fields, 32)
+		} else {
+			msg.Fields[32] = acquirer
+		}
+		return msg
+	}
+	tests := []struct {
+		name         string
+		bound        string
+		bindAcquirer bool
+		first        *domain.ISO8583Message
+		msg          *domain.ISO8583Message
+		want         bool
+	}{
+		{"unbound session", "", false, nil, withF32("970415"), true},
+		{"bound acquirer", "970436", false, nil, withF32("970436"), true},
+		{"other acquirer", "970436", false, nil, withF32("970415"), false},
+		{"request without F32", "970436", false, nil, withF32(""), false},
+		{"network management without F32", "970436", false, nil, echoTest("trace-1"), true},
+		{"bound by first message", "", true, withF32("970436"), withF32("970436"), true},
+		{"other acquirer than first message", "", true, withF32("970436"), withF32("970415"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t, "gw-1", nil)
+			h.inbound.listener = NewListenerPolicy(&config.ListenerConfig{Name: "atm", BindAcquirer: tt.bindAcquirer})
+			if tt.bound != "" {
+				h.session.BindAcquirer(tt.bound)
+			}
+			if tt.first != nil {
+				expectAdmitted(h, tt.first)
+			}
+			if tt.want {
+				expectAdmitted(h, tt.msg)
+				h.expectSilence()
+			} else {
+				expectRefused(h, tt.msg)
+			}
+		})
+	}
+}
+
+func TestAdmitInstitutionSessionLimit(t *testing.T) {
+	h := newHarness(t, "gw-1", nil)
+	h.inbound.listener = NewListenerPolicy(&config.ListenerConfig{Name: "atm", MaxSessionsPerInstitution: 1})
+
+	// Another session of the same instance already sends for 970436.
+	conn, peer := net.Pipe()
+	t.Cleanup(func() { _ = conn.Close(); _ = peer.Close() })
+	other := session.NewSession(conn, nil, handler.FramingASCII4)
+	h.sessions.Add(other)
+	if _, allowed := h.sessions.Bind(other, "970436", 1); !allowed {
+		t.Fatal("first session of 970436 refused")
+	}
+
+	expectRefused(h, transfer("trace-1", "000001"))
+	expectRefused(h, transfer("trace-2", "000002"))
+
+	// Once the other session closes, its place is free.
+	h.sessions.Remove(other)
+	expectAdmitted(h, transfer("trace-3", "000003"))
+	expectAdmitted(h, transfer("trace-4", "000004"))
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"iso8583-gateway/internal/domain"
+	"testing"
+	"time"
+)
+
+// resend is a copy of request under a new trace ID, as a partner that lost
+// the response sends it.
+func resend(request *domain.ISO8583Message, mti string, traceID string) *domain.ISO8583Message {
+	fields := make(map[int]string, len(request.Fields))
+	for i, f := range request.Fields {
+		fields[i] = f
+	}
+	fields[63] = traceID
+	msg := domain.NewISO8583Message(mti, fields)
+	msg.ReceivedAt = time.Now()
+	return msg
+}
+
+func TestDuplicateReplaysResponse(t *testing.T) {
+	h := newHarness(t, "gw-1", idleSubscriber{})
+	request := transfer("trace-1", "000001")
+	h.inbound.processInbound(request)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.responses.processResponse(responseRecord(t, "gw-1", "trace-1", request, responseCodeApproved))
+	}()
+	first := h.receive()
+	// The response is cached once it has been written.
+	<-done
+
+	go h.inbound.processInbound(resend(request, "0201", "trace-2"))
+	replayed := h.receive()
+	if replayed.MTI != first.MTI || replayed.Fields[39] != first.Fields[39] || replayed.Fields[63] != "trace-1" {
+		t.Errorf("replayed %s F39 %q F63 %q, want the response to trace-1", replayed.MTI, replayed.Fields[39], replayed.Fields[63])
+	}
+	if published := h.pub.Messages(h.cfg.InboundRequestTopic); len(published) != 1 {
+		t.Errorf("got %d published requests, want 1", len(published))
+	}
+}
+
+func TestDuplicateInFlightSuppressed(t *testing.T) {
+	h := newHarness(t, "gw-1", idleSubscriber{})
+	request := transfer("trace-1", "000001")
+	h.inbound.processInbound(request)
+	h.inbound.processInbound(resend(request, "0200", "trace-2"))
+
+	h.expectSilence()
+	if published := h.pub.Messages(h.cfg.InboundRequestTopic); len(published) != 1 {
+		t.Errorf("got %d published requests, want 1", len(published))
+	}
+}
+
+// A repeat advice (0421) is acknowledged by the gateway once the first copy
+// is no longer waiting for the backend, and left to the backend's answer
+// while it is.
+func TestDuplicateAdviceAcknowledged(t *testing.T) {
+	h := newHarness(t, "gw-1", idleSubscriber{})
+	original := transfer("trace-1", "000001")
+	advice := domain.NewISO8583Message("0420", map[int]string{
+		3:   original.Fields[3],
+		4:   original.Fields[4],
+		7:   "1019093115",
+		11:  "000002",
+		32:  original.Fields[32],
+		37:  original.Fields[37],
+		63:  "trace-2",
+		90:  domain.NewOriginalDataElements(original).String(),
+		100: original.Fields[100],
+	})
+	advice.ReceivedAt = time.Now()
+	h.inbound.processInbound(advice)
+
+	h.inbound.processInbound(resend(advice, "0421", "trace-3"))
+	h.expectSilence()
+
+	// The backend answered the first copy, but its response was not cached.
+	if _, err := h.correlations.Match("trace-2", advice); err != nil {
+		t.Fatal(err)
+	}
+	go h.inbound.processInbound(resend(advice, "0421", "trace-4"))
+	ack := h.receive()
+	if ack.MTI != "0430" || ack.Fields[11] != "000002" || ack.Fields[39] != responseCodeApproved {
+		t.Errorf("got %s F11 %q F39 %q, want 0430 F11 000002 F39 00", ack.MTI, ack.Fields[11], ack.Fields[39])
+	}
+	if published := h.pub.Messages(h.cfg.ReversalTopic); len(published) != 1 {
+		t.Errorf("got %d published advices, want 1", len(published))
+	}
+}
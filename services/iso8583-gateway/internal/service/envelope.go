@@ -0,0 +1,81 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/publisher"
+	"iso8583-gateway/pkg/contract"
+	"iso8583-gateway/pkg/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cloudEventsSpecVersion = "1.0"
+
+// envelopeHeaders repeats the identifying fields of a message in headers, so
+// consumers can filter records without parsing their body. With CloudEvents
+// enabled the record is also a CloudEvent in Kafka binary mode, from source.
+func envelopeHeaders(e *contract.Envelope, serializer contract.Serializer, cfg *config.ApplicationConfig, source string) []publisher.Header {
+	headers := []publisher.Header{
+		{Key: "content-type", Value: serializer.ContentType()},
+		{Key: "schema_version", Value: strconv.Itoa(e.SchemaVersion)},
+		{Key: "mti", Value: e.MTI},
+		{Key: "stan", Value: e.Fields[11]},
+		{Key: "rrn", Value: e.Fields[37]},
+	}
+	if id := serializer.SchemaID(); id != "" {
+		headers = append(headers, publisher.Header{Key: "schema", Value: id})
+	}
+	if cfg.CloudEvents {
+		headers = append(headers,
+			publisher.Header{Key: "ce_specversion", Value: cloudEventsSpecVersion},
+			publisher.Header{Key: "ce_id", Value: e.TraceID},
+			publisher.Header{Key: "ce_type", Value: cloudEventType(cfg.CloudEventsTypePrefix, e)},
+			publisher.Header{Key: "ce_source", Value: source},
+			publisher.Header{Key: "ce_time", Value: e.ReceivedAt.Format(time.RFC3339Nano)},
+			publisher.Header{Key: "traceparent", Value: traceParent(e.TraceID)},
+		)
+	}
+	return headers
+}
+
+// cloudEventType is the prefix, the MTI and the transaction type of F3, e.g.
+// iso8583.gateway.0200.91. Messages without F3 end with the MTI.
+func cloudEventType(prefix string, e *contract.Envelope) string {
+	eventType := prefix + "." + e.MTI
+	if f3 := e.Fields[3]; len(f3) >= 2 {
+		eventType += "." + f3[:2]
+	}
+	return eventType
+}
+
+// cloudEventSource names the gateway instance and, for messages received from
+// a partner, the listener and the peer IP, e.g.
+// /iso8583-gateway/<service ID>/listeners/default/peers/10.0.0.12. The peer
+// port is left out, so the source stays the same across reconnects.
+func cloudEventSource(serviceID string, listener string, remoteAddr string) string {
+	source := "/iso8583-gateway/" + serviceID
+	if listener != "" {
+		source += "/listeners/" + listener
+	}
+	if ip, ok := util.RemoteIP(remoteAddr); ok {
+		source += "/peers/" + ip.String()
+	}
+	return source
+}
+
+// traceParent builds a W3C traceparent whose trace ID is derived from the
+// gateway trace ID: a UUID is used as is, anything else is hashed.
+func traceParent(traceID string) string {
+	id := strings.ReplaceAll(strings.ToLower(traceID), "-", "")
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 32 {
+		sum := sha256.Sum256([]byte(traceID))
+		id = hex.EncodeToString(sum[:16])
+	}
+	span := make([]byte, 8)
+	rand.Read(span)
+	return "00-" + id + "-" + hex.EncodeToString(span) + "-01"
+}
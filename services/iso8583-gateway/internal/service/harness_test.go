@@ -0,0 +1,195 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/correlation"
+	"iso8583-gateway/internal/dedupe"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/handler"
+	"iso8583-gateway/internal/journal"
+	"iso8583-gateway/internal/profile"
+	"iso8583-gateway/internal/publisher"
+	"iso8583-gateway/internal/reversal"
+	"iso8583-gateway/internal/rules"
+	"iso8583-gateway/internal/session"
+	"iso8583-gateway/internal/validation"
+	"iso8583-gateway/pkg/contract"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// harness is one gateway instance with a single partner session. The partner
+// end of the session is peer; publishing goes to an in-memory sink.
+type harness struct {
+	t            *testing.T
+	ctx          context.Context
+	cancel       context.CancelFunc
+	cfg          *config.ApplicationConfig
+	pub          *publisher.Memory
+	sessions     *session.Registry
+	directory    *SessionDirectory
+	correlations *correlation.Store
+	dedupes      *dedupe.Store
+	journal      *journal.Journal
+	reversals    *ReversalService
+	responses    *ResponseService
+	inbound      *InboundService
+	session      *session.Session
+	peer         net.Conn
+	peerReader   *bufio.Reader
+	profile      *profile.Profile
+}
+
+func testConfig(serviceID string) *config.ApplicationConfig {
+	return &config.ApplicationConfig{
+		InboundRequestTopic:   "transfer.inbound.request",
+		InboundResponseTopic:  "transfer.inbound.response",
+		SessionDirectoryTopic: "gateway.session.directory",
+		ResponseRouting:       config.ResponseRoutingPartition,
+		DefaultSLATimeout:     30 * time.Second,
+		LatencySLA:            time.Second,
+		CorrelationRetention:  5 * time.Minute,
+		ReversalTopic:         "transfer.reversal.request",
+		AdviceTopic:           "transfer.advice.request",
+		DedupeWindow:          10 * time.Minute,
+		DeadLetterTopic:       "transfer.inbound.dlq",
+		Serializer:            contract.FormatJSON,
+		UnroutableAction:      config.UnroutableReject,
+		ReversalRetryInterval: 30 * time.Second,
+		ServiceID:             serviceID,
+	}
+}
+
+func newHarness(t *testing.T, serviceID string, subscriber publisher.Subscriber) *harness {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	dir := t.TempDir()
+	cfg := testConfig(serviceID)
+	j, err := journal.Open(&config.JournalConfig{Dir: filepath.Join(dir, "journal"), Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+	store, err := reversal.NewFileStore(filepath.Join(dir, "reversals.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serializer, err := contract.NewSerializer(cfg.Serializer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := rules.Load(&config.RulesConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := validation.Load(&config.ValidationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles, err := profile.Load(&config.ProfileConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	napas, _ := profiles.Get("napas")
+
+	h := &harness{t: t, ctx: ctx, cancel: cancel, cfg: cfg, pub: publisher.NewMemory(), journal: j, profile: napas}
+	h.sessions = session.NewRegistry()
+	h.directory = NewSessionDirectory(ctx, cfg, h.pub, subscriber)
+	h.correlations = correlation.NewStore(cfg.CorrelationRetention)
+	h.dedupes = dedupe.NewStore(cfg.DedupeWindow)
+	h.reversals = NewReversalService(ctx, cfg, h.pub, store, j, serializer)
+	h.responses = NewResponseService(ctx, cfg, h.pub, subscriber, h.sessions, h.directory, h.correlations, h.reversals, h.dedupes, j, NewInstitutions())
+
+	conn, peer := net.Pipe()
+	t.Cleanup(func() { _ = conn.Close(); _ = peer.Close() })
+	h.peer = peer
+	h.peerReader = bufio.NewReader(peer)
+	h.session = session.NewSession(conn, profiles.Select(napas, "10.0.0.1:40000"), handler.FramingASCII4)
+	h.sessions.Add(h.session)
+	policy := NewListenerPolicy(&config.ListenerConfig{Name: "default"})
+	h.inbound = NewInboundService(ctx, make(chan *domain.ISO8583Message), cfg, h.pub, h.session, h.sessions, h.directory, h.correlations, h.dedupes, j, engine, serializer, validator, policy, NewInstitutions())
+	return h
+}
+
+// receive reads the next frame written to the partner, failing the test if
+// none arrives in time.
+func (h *harness) receive() *domain.ISO8583Message {
+	h.t.Helper()
+	msg, err := h.read(2 * time.Second)
+	if err != nil {
+		h.t.Fatalf("no frame written to the partner: %v", err)
+	}
+	return msg
+}
+
+// expectSilence fails the test if a frame is written to the partner.
+func (h *harness) expectSilence() {
+	h.t.Helper()
+	if msg, err := h.read(200 * time.Millisecond); err == nil {
+		h.t.Fatalf("unexpected frame written to the partner: %s %v", msg.MTI, msg.Fields)
+	}
+}
+
+func (h *harness) read(timeout time.Duration) (*domain.ISO8583Message, error) {
+	if err := h.peer.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(h.peerReader, header); err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(string(header))
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(h.peerReader, body); err != nil {
+		return nil, err
+	}
+	return h.profile.Parse(body)
+}
+
+// transfer is a 0200 fund transfer from acquirer 970436 traced as traceID.
+func transfer(traceID string, stan string) *domain.ISO8583Message {
+	msg := domain.NewISO8583Message("0200", map[int]string{
+		2:   "9704366614952079",
+		3:   "912000",
+		4:   "000001500000",
+		7:   "1019093015",
+		11:  stan,
+		32:  "970436",
+		37:  "629209" + stan,
+		41:  "ATM00001",
+		49:  "704",
+		63:  traceID,
+		100: "970400",
+		103: "0123456789",
+	})
+	msg.ReceivedAt = time.Now()
+	return msg
+}
+
+// responseRecord is a backend response to request, addressed to serviceID.
+func responseRecord(t *testing.T, serviceID string, traceID string, request *domain.ISO8583Message, rc string) *publisher.Record {
+	t.Helper()
+	value, err := json.Marshal(domain.NewResponse(request, rc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &publisher.Record{
+		Topic: "transfer.inbound.response",
+		Value: value,
+		Headers: []publisher.Header{
+			{Key: "service_id", Value: serviceID},
+			{Key: "trace_id", Value: traceID},
+		},
+	}
+}
@@ -2,27 +2,83 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/correlation"
+	"iso8583-gateway/internal/dedupe"
 	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/journal"
+	"iso8583-gateway/internal/publisher"
+	"iso8583-gateway/internal/rules"
+	"iso8583-gateway/internal/session"
+	"iso8583-gateway/internal/validation"
+	"iso8583-gateway/pkg/audit"
+	"iso8583-gateway/pkg/contract"
+	"iso8583-gateway/pkg/metrics"
+	"iso8583-gateway/pkg/tracing"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+const (
+	routeDefault  = "default"
+	routeReversal = "reversal"
+	routeAdvice   = "advice"
+
+	responseCodeNoRoute     = "92"
+	responseCodeFormatError = "30"
+	responseCodeRateLimited = "91"
+	responseCodeNotAllowed  = "58"
+	responseCodeUnavailable = "91"
+
+	refusalAcquirerMismatch        = "acquirer_mismatch"
+	refusalInstitutionSessionLimit = "institution_session_limit"
+)
+
+var errUnroutable = errors.New("no route for message")
+
 type InboundService struct {
 	ctx               context.Context
 	inboundChan       chan *domain.ISO8583Message
 	applicationConfig *config.ApplicationConfig
-	producer          sarama.SyncProducer
+	publisher         publisher.Publisher
+	session           *session.Session
+	sessions          *session.Registry
+	directory         *SessionDirectory
+	correlations      *correlation.Store
+	dedupes           *dedupe.Store
+	journal           *journal.Journal
+	rules             *rules.Engine
+	serializer        contract.Serializer
+	validator         *validation.Validator
+	listener          *ListenerPolicy
+	institutions      *Institutions
 }
 
-func NewInboundService(ctx context.Context, inboundChan chan *domain.ISO8583Message, applicationConfig *config.ApplicationConfig, producer sarama.SyncProducer) *InboundService {
+func NewInboundService(ctx context.Context, inboundChan chan *domain.ISO8583Message, applicationConfig *config.ApplicationConfig, publisher publisher.Publisher, s *session.Session, sessions *session.Registry, directory *SessionDirectory, correlations *correlation.Store, dedupes *dedupe.Store, j *journal.Journal, engine *rules.Engine, serializer contract.Serializer, validator *validation.Validator, listener *ListenerPolicy, institutions *Institutions) *InboundService {
 	return &InboundService{
 		ctx:               ctx,
 		inboundChan:       inboundChan,
 		applicationConfig: applicationConfig,
-		producer:          producer,
+		publisher:         publisher,
+		session:           s,
+		sessions:          sessions,
+		directory:         directory,
+		correlations:      correlations,
+		dedupes:           dedupes,
+		journal:           j,
+		rules:             engine,
+		serializer:        serializer,
+		validator:         validator,
+		listener:          listener,
+		institutions:      institutions,
 	}
 }
 
@@ -48,23 +104,427 @@ func (service *InboundService) processInbound(v *domain.ISO8583Message) {
 		zap.L().Warn("Ignore message with empty F63", zap.Any("fields", v.Fields))
 		return
 	}
-	bytes, err := json.Marshal(v)
+	if !service.admit(v, f63) {
+		return
+	}
+	if !service.listener.allow() {
+		metrics.RateLimited.WithLabelValues(service.listener.Name).Inc()
+		zap.L().Warn("Reject message over listener rate limit", zap.String("listener", service.listener.Name), zap.String("f63", f63), zap.String("mti", v.MTI))
+		if domain.ExpectsResponse(v.MTI) {
+			service.journalRequest(v, f63)
+			service.reject(v, f63, responseCodeRateLimited)
+		}
+		return
+	}
+	if domain.ExpectsResponse(v.MTI) && service.handleDuplicate(v, f63) {
+		return
+	}
+	if domain.ExpectsResponse(v.MTI) && !service.validate(v, f63) {
+		return
+	}
+	decision := service.rules.Evaluate(v)
+	switch decision.Action {
+	case rules.ActionDrop:
+		zap.L().Warn("Drop message by rule", zap.String("rule", decision.Rule), zap.String("f63", f63), zap.String("mti", v.MTI))
+		return
+	case rules.ActionReject:
+		service.journalRequest(v, f63)
+		if domain.ExpectsResponse(v.MTI) {
+			service.reject(v, f63, decision.ResponseCode)
+		}
+		return
+	}
+	route, ok := service.route(v, decision)
+	if !ok {
+		service.handleUnroutable(v, f63)
+		return
+	}
+	if domain.ExpectsResponse(v.MTI) {
+		entry := correlation.NewEntry(f63, service.session.ID, v, service.applicationConfig.SLATimeout(v.MTI))
+		if err := service.correlations.Register(entry); err != nil {
+			zap.L().Warn("Ignore message already waiting for a response", zap.Error(err), zap.String("f63", f63), zap.String("key", entry.Key))
+			return
+		}
+	}
+	headers := []publisher.Header{
+		{Key: "service_id", Value: service.applicationConfig.ServiceID},
+		{Key: "trace_id", Value: f63},
+		{Key: "route", Value: route.Name},
+	}
+	envelope := service.envelope(v, f63)
+	headers = append(headers, envelopeHeaders(envelope, service.serializer, service.applicationConfig, service.source())...)
+	if len(decision.Tags) > 0 {
+		headers = append(headers, publisher.Header{Key: "tags", Value: strings.Join(decision.Tags, ",")})
+	}
+	if domain.IsReversal(v.MTI) || domain.IsAdvice(v.MTI) {
+		headers = append(headers, publisher.Header{Key: "original_trace_id", Value: service.originalTraceID(v, f63)})
+	}
+	service.journalRequest(v, f63)
+	ctx, span := tracing.Tracer().Start(v.TraceContext(), "inbound.publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.destination.name", route.Topic), attribute.String("iso8583.mti", v.MTI), attribute.String("iso8583.trace_id", f63), attribute.String("gateway.route", route.Name)),
+	)
+	defer span.End()
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{headers: &headers})
+	msg, receipt, err := service.publish(v, envelope, f63, route.Topic, headers)
+	status := journal.StatusPublished
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "publish failed")
+		status = journal.StatusPublishFailed
+		if msg != nil && service.deadLetter(v, msg, f63, err) {
+			status = journal.StatusDeadLettered
+		}
+	} else {
+		span.SetAttributes(attribute.Int("messaging.kafka.destination.partition", int(receipt.Partition)), attribute.Int64("messaging.kafka.message.offset", receipt.Offset))
+	}
+	service.journalPublished(f63, route.Topic, receipt, status)
+	if err != nil && domain.ExpectsResponse(v.MTI) {
+		// The backend never got the request, so it is answered now rather
+		// than timed out and reversed.
+		service.correlations.Remove(f63)
+		service.answer(v, f63, responseCodeUnavailable, status)
+	}
+}
+
+// validate rejects a message that breaks its field specs with a format error,
+// so it never reaches the backend.
+func (service *InboundService) validate(v *domain.ISO8583Message, f63 string) bool {
+	violations := service.validator.Validate(v)
+	if len(violations) == 0 {
+		return true
+	}
+	reasons := make([]string, len(violations))
+	for i, violation := range violations {
+		reasons[i] = violation.String()
+		metrics.ValidationViolations.WithLabelValues(violation.Spec, strconv.Itoa(violation.Field), violation.Kind).Inc()
+	}
+	zap.L().Warn("Reject invalid message", zap.String("f63", f63), zap.String("mti", v.MTI), zap.String("f3", v.Fields[3]), zap.Strings("violations", reasons))
+	service.journalRequest(v, f63)
+	service.reject(v, f63, responseCodeFormatError)
+	return false
+}
+
+func (service *InboundService) publish(v *domain.ISO8583Message, envelope *contract.Envelope, f63 string, topic string, headers []publisher.Header) (*publisher.Message, publisher.Receipt, error) {
+	bytes, err := service.serializer.Marshal(envelope)
+	if err != nil {
+		zap.L().Error("Failed to serialize message", zap.Error(err), zap.Any("message", v), zap.String("f63", f63))
+		return nil, publisher.Receipt{}, err
+	}
+	msg := &publisher.Message{
+		Topic:   topic,
+		Value:   bytes,
+		Headers: headers,
+	}
+	receipt, err := publishWith(service.publisher, msg, service.journalRecords(v, f63, topic, journal.StatusPublished))
+	if err != nil {
+		zap.L().Error("Failed to publish message", zap.Error(err), zap.Any("message", v), zap.String("f63", f63))
+		return msg, receipt, err
+	}
+	zap.L().Info("Successfully published message", zap.Any("message", v), zap.String("f63", f63), zap.String("topic", topic), zap.Int64("offset", receipt.Offset), zap.Int32("partition", receipt.Partition))
+	return msg, receipt, nil
+}
+
+// source is the CloudEvents source of the messages received on the session.
+func (service *InboundService) source() string {
+	return cloudEventSource(service.applicationConfig.ServiceID, service.listener.Name, service.session.RemoteAddr)
+}
+
+func (service *InboundService) envelope(v *domain.ISO8583Message, f63 string) *contract.Envelope {
+	return domain.NewEnvelope(v, f63, service.applicationConfig.ServiceID, service.session.ID, service.session.RemoteAddr, service.applicationConfig.EnvelopeRaw)
+}
+
+// deadLetter parks a record that couldn't be published on the dead letter
+// topic, with the original topic and the failure in its headers, and with its
+// journal record in the same transaction. With a transactional producer the
+// failed send was already aborted, so the record is never committed to both
+// topics, but it may be committed to neither.
+func (service *InboundService) deadLetter(v *domain.ISO8583Message, failed *publisher.Message, f63 string, cause error) bool {
+	headers := append([]publisher.Header{}, failed.Headers...)
+	headers = append(headers,
+		publisher.Header{Key: "original_topic", Value: failed.Topic},
+		publisher.Header{Key: "dlq_reason", Value: cause.Error()},
+	)
+	msg := &publisher.Message{
+		Topic:   service.applicationConfig.DeadLetterTopic,
+		Value:   failed.Value,
+		Headers: headers,
+	}
+	receipt, err := publishWith(service.publisher, msg, service.journalRecords(v, f63, msg.Topic, journal.StatusDeadLettered))
 	if err != nil {
-		zap.L().Error("Failed to marshal ISO8583Message to JSON", zap.Error(err), zap.Any("message", v), zap.String("f63", f63))
+		zap.L().Error("Failed to send message to dead letter topic", zap.Error(err), zap.String("f63", f63))
+		return false
+	}
+	zap.L().Warn("Sent message to dead letter topic", zap.String("f63", f63), zap.String("topic", msg.Topic), zap.Int64("offset", receipt.Offset), zap.Int32("partition", receipt.Partition))
+	return true
+}
+
+// route picks the topic of an inbound message. A route rule that fired wins,
+// then the routes of the listener and the configured routes; reversals and
+// advices no route claims go to their own topics and anything else to the
+// request topic, the default route, unless it is disabled.
+func (service *InboundService) route(v *domain.ISO8583Message, decision rules.Decision) (config.Route, bool) {
+	cfg := service.applicationConfig
+	if decision.Action == rules.ActionRoute {
+		return config.Route{Name: decision.Rule, Topic: decision.Topic}, true
+	}
+	if route, ok := service.listener.matchRoute(v.MTI, v.Fields[3], v.Fields[100]); ok {
+		return route, true
+	}
+	if route, ok := cfg.MatchRoute(v.MTI, v.Fields[3], v.Fields[100]); ok {
+		return route, true
+	}
+	switch {
+	case domain.IsReversal(v.MTI):
+		return config.Route{Name: routeReversal, Topic: cfg.ReversalTopic}, true
+	case domain.IsAdvice(v.MTI):
+		return config.Route{Name: routeAdvice, Topic: cfg.AdviceTopic}, true
+	case cfg.InboundRequestTopic != "":
+		return config.Route{Name: routeDefault, Topic: cfg.InboundRequestTopic}, true
+	}
+	return config.Route{}, false
+}
+
+// handleUnroutable answers a message no route matches with RC 92 when a
+// response is expected. With the dead letter action it is also parked on the
+// dead letter topic first.
+func (service *InboundService) handleUnroutable(v *domain.ISO8583Message, f63 string) {
+	zap.L().Warn("No route for message", zap.String("f63", f63), zap.String("mti", v.MTI), zap.String("f3", v.Fields[3]), zap.String("f100", v.Fields[100]), zap.String("action", service.applicationConfig.UnroutableAction))
+	service.journalRequest(v, f63)
+	status := journal.StatusRejected
+	if service.applicationConfig.UnroutableAction == config.UnroutableDeadLetter {
+		status = service.deadLetterUnroutable(v, f63)
+	}
+	if domain.ExpectsResponse(v.MTI) {
+		service.answer(v, f63, responseCodeNoRoute, status)
+	}
+}
+
+// deadLetterUnroutable parks an unroutable message on the dead letter topic
+// and returns its journal status.
+func (service *InboundService) deadLetterUnroutable(v *domain.ISO8583Message, f63 string) string {
+	envelope := service.envelope(v, f63)
+	bytes, err := service.serializer.Marshal(envelope)
+	if err != nil {
+		zap.L().Error("Failed to serialize message", zap.Error(err), zap.Any("message", v), zap.String("f63", f63))
+		service.journalPublished(f63, "", publisher.Receipt{}, journal.StatusPublishFailed)
+		return journal.StatusPublishFailed
+	}
+	msg := &publisher.Message{
+		Value: bytes,
+		Headers: append([]publisher.Header{
+			{Key: "service_id", Value: service.applicationConfig.ServiceID},
+			{Key: "trace_id", Value: f63},
+		}, envelopeHeaders(envelope, service.serializer, service.applicationConfig, service.source())...),
+	}
+	status := journal.StatusPublishFailed
+	if service.deadLetter(v, msg, f63, errUnroutable) {
+		status = journal.StatusDeadLettered
+	}
+	service.journalPublished(f63, "", publisher.Receipt{}, status)
+	return status
+}
+
+// admit checks F32 against the acquirer the session is bound to, and binds
+// the institution to the session within the listener's session limit. A
+// refused request is answered with 58.
+func (service *InboundService) admit(v *domain.ISO8583Message, f63 string) bool {
+	institution := v.Fields[32]
+	expected := service.session.Acquirer()
+	if service.listener.BindAcquirer && institution != "" {
+		expected = service.session.BindAcquirer(institution)
+	}
+	if expected != "" && institution != expected && (institution != "" || !domain.IsNetworkManagement(v.MTI)) {
+		service.refuse(v, f63, refusalAcquirerMismatch, zap.String("acquirer", institution), zap.String("expected_acquirer", expected))
+		return false
+	}
+	if institution == "" {
+		return true
+	}
+	first, allowed := service.sessions.Bind(service.session, institution, service.listener.MaxSessionsPerInstitution)
+	if !allowed {
+		service.refuse(v, f63, refusalInstitutionSessionLimit, zap.String("acquirer", institution), zap.Int("max_sessions", service.listener.MaxSessionsPerInstitution))
+		return false
+	}
+	if first {
+		service.directory.Announce(institution)
+	}
+	return true
+}
+
+func (service *InboundService) refuse(v *domain.ISO8583Message, f63 string, reason string, fields ...zap.Field) {
+	metrics.AccessRefusals.WithLabelValues(service.listener.Name, reason).Inc()
+	zap.L().Warn("Refuse message by access control", append([]zap.Field{zap.String("listener", service.listener.Name), zap.String("reason", reason), zap.String("session_id", service.session.ID), zap.String("remote_addr", service.session.RemoteAddr), zap.String("f63", f63), zap.String("mti", v.MTI)}, fields...)...)
+	if domain.ExpectsResponse(v.MTI) {
+		service.journalRequest(v, f63)
+		service.reject(v, f63, responseCodeNotAllowed)
+	}
+}
+
+// reject answers a request on the backend's behalf with the given response
+// code.
+func (service *InboundService) reject(v *domain.ISO8583Message, f63 string, rc string) {
+	service.answer(v, f63, rc, journal.StatusRejected)
+}
+
+// answer responds to v on the gateway's behalf with rc and journals the
+// response with status.
+func (service *InboundService) answer(v *domain.ISO8583Message, f63 string, rc string, status string) {
+	response := domain.NewResponse(v, rc)
+	raw, err := service.session.Write(response)
+	if err != nil {
+		zap.L().Error("Failed to write rejection to session", zap.Error(err), zap.String("session_id", service.session.ID), zap.String("f63", f63))
 		return
 	}
-	msg := &sarama.ProducerMessage{
-		Topic: service.applicationConfig.InboundRequestTopic,
-		Value: sarama.ByteEncoder(bytes),
-		Headers: []sarama.RecordHeader{
-			{Key: []byte("service_id"), Value: []byte(service.applicationConfig.ServiceID)},
-			{Key: []byte("trace_id"), Value: []byte(f63)},
-		},
+	service.dedupes.SetResponse(dedupe.Key(response), response)
+	observeResponse(service.applicationConfig, service.institutions, service.session, v, response)
+	journaled, err := service.journal.NewMessage(response, raw, time.Now())
+	if err != nil {
+		zap.L().Error("Failed to prepare response for journal", zap.Error(err), zap.String("f63", f63))
+		return
 	}
-	partition, offset, err := service.producer.SendMessage(msg)
+	err = service.journal.Update(f63, func(t *journal.Transaction) {
+		t.Response = journaled
+		t.Status = status
+	})
 	if err != nil {
-		zap.L().Error("Failed to send message to Kafka", zap.Error(err), zap.Any("message", v), zap.String("f63", f63))
+		zap.L().Error("Failed to journal rejection", zap.Error(err), zap.String("f63", f63))
+	}
+}
+
+// journalRequest records the request before it is published, so a response
+// racing the publish acknowledgement always finds it.
+func (service *InboundService) journalRequest(v *domain.ISO8583Message, f63 string) {
+	request, err := service.journal.NewMessage(v, v.Raw, v.ReceivedAt)
+	if err != nil {
+		zap.L().Error("Failed to prepare request for journal", zap.Error(err), zap.String("f63", f63))
 		return
 	}
-	zap.L().Info("Successfully sent message to Kafka", zap.Any("message", v), zap.String("f63", f63), zap.Int64("offset", offset), zap.Int32("partition", partition))
+	t := &journal.Transaction{
+		TraceID:                f63,
+		Key:                    correlation.Key(v),
+		DedupeKey:              dedupe.Key(v),
+		SessionID:              service.session.ID,
+		RemoteAddr:             service.session.RemoteAddr,
+		DestinationAccountHash: service.journal.HashAccount(v.Fields[103]),
+		Status:                 journal.StatusReceived,
+		Request:                request,
+	}
+	if err := service.journal.Put(t); err != nil {
+		zap.L().Error("Failed to journal request", zap.Error(err), zap.String("f63", f63))
+	}
+}
+
+func (service *InboundService) journalPublished(f63 string, topic string, receipt publisher.Receipt, status string) {
+	err := service.journal.Update(f63, func(t *journal.Transaction) {
+		if status != journal.StatusPublished {
+			t.Status = status
+			return
+		}
+		t.Topic = topic
+		t.Partition = receipt.Partition
+		t.Offset = receipt.Offset
+		if t.Status == journal.StatusReceived {
+			t.Status = journal.StatusPublished
+		}
+	})
+	if err != nil {
+		zap.L().Error("Failed to journal publish outcome", zap.Error(err), zap.String("f63", f63))
+	}
+}
+
+// originalTraceID finds the trace ID of the transaction a reversal or advice
+// refers to in F90. It returns "" when F90 is absent, malformed or unknown.
+func (service *InboundService) originalTraceID(v *domain.ISO8583Message, f63 string) string {
+	if _, ok := v.Fields[90]; !ok {
+		return ""
+	}
+	original, err := v.OriginalDataElements()
+	if err != nil {
+		zap.L().Warn("Invalid original data elements", zap.Error(err), zap.String("f63", f63))
+		return ""
+	}
+	t, err := service.journal.FindByKey(correlation.OriginalKey(original))
+	if err != nil {
+		zap.L().Warn("Original transaction not found", zap.Error(err), zap.String("f63", f63), zap.String("original_mti", original.MTI), zap.String("original_stan", original.STAN), zap.String("original_f7", original.TransmissionDateTime), zap.String("original_f32", original.AcquirerID))
+		return ""
+	}
+	zap.L().Info("Matched original transaction", zap.String("f63", f63), zap.String("original_trace_id", t.TraceID), zap.String("original_status", t.Status))
+	return t.TraceID
+}
+
+// handleDuplicate answers a retransmission of a request seen within the dedupe
+// window instead of forwarding it to the backend again: the cached response is
+// replayed if there is one, otherwise the copy is suppressed. Requests seen
+// before a restart are found in the journal. It reports false for a first
+// transmission.
+func (service *InboundService) handleDuplicate(v *domain.ISO8583Message, f63 string) bool {
+	key := dedupe.Key(v)
+	record, seen := service.dedupes.Seen(key, f63)
+	var replay func() error
+	if seen && record.Response != nil {
+		replay = func() error {
+			_, err := service.session.Write(record.Response)
+			return err
+		}
+	}
+	if !seen {
+		t, err := service.journal.FindByDedupeKey(key, time.Now().Add(-service.applicationConfig.DedupeWindow))
+		if err != nil {
+			metrics.DedupeDecisions.WithLabelValues(metrics.DecisionAccepted).Inc()
+			return false
+		}
+		record = dedupe.Record{TraceID: t.TraceID, SeenAt: t.Request.At}
+		if t.Response != nil {
+			if frame, err := service.journal.DecryptFrame(t.Response); err == nil {
+				replay = func() error {
+					return service.session.WriteRaw(frame)
+				}
+			}
+		}
+	}
+	if replay != nil {
+		if err := replay(); err != nil {
+			zap.L().Error("Failed to replay response to duplicate", zap.Error(err), zap.String("session_id", service.session.ID), zap.String("f63", f63))
+		}
+		service.recordDuplicate(metrics.DecisionReplayed, v, f63, key, record)
+		return true
+	}
+	if domain.IsAdvice(v.MTI) && service.acknowledgeAdvice(v, f63) {
+		service.recordDuplicate(metrics.DecisionAcknowledged, v, f63, key, record)
+		return true
+	}
+	service.recordDuplicate(metrics.DecisionSuppressed, v, f63, key, record)
+	return true
+}
+
+func (service *InboundService) recordDuplicate(decision string, v *domain.ISO8583Message, f63 string, key string, record dedupe.Record) {
+	metrics.DedupeDecisions.WithLabelValues(decision).Inc()
+	audit.Record("duplicate_transmission",
+		zap.String("decision", decision),
+		zap.String("mti", v.MTI),
+		zap.String("key", key),
+		zap.String("f63", f63),
+		zap.String("original_f63", record.TraceID),
+		zap.Time("first_seen_at", record.SeenAt),
+		zap.String("session_id", service.session.ID),
+		zap.String("remote_addr", service.session.RemoteAddr),
+	)
+}
+
+// acknowledgeAdvice answers a repeated advice (0221, 0421) whose first copy
+// the backend has already answered, or timed out on, but whose response wasn't
+// cached. Advices are acknowledged unconditionally, so the gateway can answer
+// on its own. It reports false while the first copy is still waiting for the
+// backend, whose answer will acknowledge it.
+func (service *InboundService) acknowledgeAdvice(v *domain.ISO8583Message, f63 string) bool {
+	_, state, ok := service.correlations.Lookup(correlation.Key(v))
+	if ok && state == correlation.StatePending {
+		return false
+	}
+	ack := domain.NewResponse(v, responseCodeApproved)
+	if _, err := service.session.Write(ack); err != nil {
+		zap.L().Error("Failed to acknowledge repeat advice", zap.Error(err), zap.String("session_id", service.session.ID), zap.String("f63", f63))
+	}
+	return true
 }
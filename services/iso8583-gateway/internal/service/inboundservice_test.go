@@ -0,0 +1,165 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/correlation"
+	"iso8583-gateway/internal/journal"
+	"strconv"
+	"testing"
+)
+
+func TestInboundPublishesRequest(t *testing.T) {
+	h := newHarness(t, "gw-1", nil)
+	request := transfer("trace-1", "000001")
+	h.inbound.processInbound(request)
+
+	published := h.pub.Messages(h.cfg.InboundRequestTopic)
+	if len(published) != 1 {
+		t.Fatalf("got %d published requests, want 1", len(published))
+	}
+	msg := &published[0]
+	for key, want := range map[string]string{"service_id": "gw-1", "trace_id": "trace-1", "route": routeDefault} {
+		if got := header(msg.Headers, key); got != want {
+			t.Errorf("header %s = %q, want %q", key, got, want)
+		}
+	}
+	if _, state, ok := h.correlations.Lookup(correlation.Key(request)); !ok || state != correlation.StatePending {
+		t.Errorf("request is not waiting for a response")
+	}
+	assertStatus(t, h.journal, "trace-1", journal.StatusPublished)
+}
+
+func TestInboundPublishFailure(t *testing.T) {
+	h := newHarness(t, "gw-1", nil)
+	h.pub.FailWith(errors.New("broker unavailable"))
+	request := transfer("trace-1", "000001")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.inbound.processInbound(request)
+	}()
+	// The backend never got the request, so the partner is answered at once
+	// instead of after the SLA timeout.
+	response := h.receive()
+	<-done
+	if response.MTI != "0210" || response.Fields[39] != responseCodeUnavailable {
+		t.Fatalf("got %s with RC %q, want 0210 with RC %s", response.MTI, response.Fields[39], responseCodeUnavailable)
+	}
+	if published := h.pub.Messages(""); len(published) != 0 {
+		t.Fatalf("got %d published messages while the sink fails, want 0", len(published))
+	}
+	if _, _, ok := h.correlations.Lookup(correlation.Key(request)); ok {
+		t.Errorf("request still waits for a response after the publish failed")
+	}
+	assertStatus(t, h.journal, "trace-1", journal.StatusPublishFailed)
+
+	h.pub.Reset()
+	h.inbound.processInbound(transfer("trace-2", "000002"))
+	if published := h.pub.Messages(h.cfg.InboundRequestTopic); len(published) != 1 {
+		t.Fatalf("got %d published requests after the sink recovered, want 1", len(published))
+	}
+	assertStatus(t, h.journal, "trace-2", journal.StatusPublished)
+}
+
+// With APP_JOURNAL_TOPIC, the journal record of a request is published in
+// the transaction of the request, or of its dead letter record.
+func TestInboundJournalRecord(t *testing.T) {
+	h := newHarness(t, "gw-1", nil)
+	h.cfg.JournalTopic = "gateway.journal"
+	h.inbound.processInbound(transfer("trace-1", "000001"))
+	assertJournalRecord(t, h, "trace-1", h.cfg.InboundRequestTopic, journal.StatusPublished)
+
+	h.pub.Reset()
+	h.cfg.InboundRequestTopic = ""
+	h.cfg.UnroutableAction = config.UnroutableDeadLetter
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.inbound.processInbound(transfer("trace-2", "000002"))
+	}()
+	h.receive()
+	<-done
+	assertJournalRecord(t, h, "trace-2", h.cfg.DeadLetterTopic, journal.StatusDeadLettered)
+}
+
+func assertJournalRecord(t *testing.T, h *harness, traceID string, topic string, status string) {
+	t.Helper()
+	if published := h.pub.Messages(topic); len(published) != 1 {
+		t.Fatalf("published %d records to %s, want 1", len(published), topic)
+	}
+	records := h.pub.Messages(h.cfg.JournalTopic)
+	if len(records) != 1 {
+		t.Fatalf("published %d journal records, want 1", len(records))
+	}
+	var record journalRecord
+	if err := json.Unmarshal(records[0].Value, &record); err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Key != traceID || record.TraceID != traceID || record.Status != status || record.Topic != topic {
+		t.Errorf("journal record %s %+v, want %s %s on %s", records[0].Key, record, traceID, status, topic)
+	}
+}
+
+func TestInboundCloudEventSource(t *testing.T) {
+	h := newHarness(t, "gw-1", nil)
+	h.cfg.CloudEvents = true
+	want := "/iso8583-gateway/gw-1/listeners/default/peers/10.0.0.1"
+	for i, remoteAddr := range []string{"10.0.0.1:40000", "10.0.0.1:40001"} {
+		h.session.RemoteAddr = remoteAddr
+		traceID := "trace-" + strconv.Itoa(i)
+		h.inbound.processInbound(transfer(traceID, fmt.Sprintf("%06d", i+1)))
+		published := h.pub.Messages(h.cfg.InboundRequestTopic)
+		if len(published) != i+1 {
+			t.Fatalf("got %d published requests, want %d", len(published), i+1)
+		}
+		if got := header(published[i].Headers, "ce_source"); got != want {
+			t.Errorf("ce_source from %s = %q, want %q", remoteAddr, got, want)
+		}
+	}
+}
+
+func TestInboundUnroutable(t *testing.T) {
+	for _, tt := range []struct {
+		action       string
+		deadLettered int
+		status       string
+	}{
+		{config.UnroutableDeadLetter, 1, journal.StatusDeadLettered},
+		{config.UnroutableReject, 0, journal.StatusRejected},
+	} {
+		t.Run(tt.action, func(t *testing.T) {
+			h := newHarness(t, "gw-1", nil)
+			h.cfg.InboundRequestTopic = ""
+			h.cfg.UnroutableAction = tt.action
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				h.inbound.processInbound(transfer("trace-1", "000001"))
+			}()
+			response := h.receive()
+			<-done
+			if response.MTI != "0210" || response.Fields[39] != responseCodeNoRoute {
+				t.Fatalf("got %s with RC %q, want 0210 with RC %s", response.MTI, response.Fields[39], responseCodeNoRoute)
+			}
+			if got := len(h.pub.Messages(h.cfg.DeadLetterTopic)); got != tt.deadLettered {
+				t.Errorf("got %d dead letter records, want %d", got, tt.deadLettered)
+			}
+			assertStatus(t, h.journal, "trace-1", tt.status)
+		})
+	}
+}
+
+func assertStatus(t *testing.T, j *journal.Journal, traceID string, want string) {
+	t.Helper()
+	transaction, err := j.Get(traceID)
+	if err != nil {
+		t.Fatalf("journal %s: %v", traceID, err)
+	}
+	if transaction.Status != want {
+		t.Errorf("journal %s status = %q, want %q", traceID, transaction.Status, want)
+	}
+}
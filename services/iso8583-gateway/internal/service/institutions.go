@@ -0,0 +1,47 @@
+package service
+
+import "sync"
+
+// institutionOther is the metric label of institutions that aren't known.
+const institutionOther = "other"
+
+// Institutions are the institution IDs known from the configuration: the
+// acquirers and route institutions of the listeners, the configured routes and
+// the spec profiles. F32 and F100 come from partners, so only these IDs and
+// the acquirer a session is bound to are used as metric labels. Anything else
+// is counted as "other", so a misbehaving peer can't create new series.
+type Institutions struct {
+	mu    sync.RWMutex
+	known map[string]bool
+}
+
+func NewInstitutions(ids ...string) *Institutions {
+	institutions := &Institutions{known: make(map[string]bool)}
+	institutions.Add(ids...)
+	return institutions
+}
+
+// Add makes ids known, e.g. when a listener is added.
+func (institutions *Institutions) Add(ids ...string) {
+	institutions.mu.Lock()
+	defer institutions.mu.Unlock()
+	for _, id := range ids {
+		if id != "" {
+			institutions.known[id] = true
+		}
+	}
+}
+
+// label returns the metric label of institution: itself when it is known or
+// is the acquirer bound is set to, "other" otherwise, and "" when it is absent.
+func (institutions *Institutions) label(institution string, bound string) string {
+	if institution == "" || institution == bound {
+		return institution
+	}
+	institutions.mu.RLock()
+	defer institutions.mu.RUnlock()
+	if institutions.known[institution] {
+		return institution
+	}
+	return institutionOther
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/pkg/metrics"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstitutionLabel(t *testing.T) {
+	institutions := NewInstitutions("970436", "")
+	institutions.Add("970415")
+	for _, tt := range []struct {
+		institution, bound, want string
+	}{
+		{"970436", "", "970436"},
+		{"970415", "", "970415"},
+		{"970499", "970499", "970499"},
+		{"970499", "970436", institutionOther},
+		{"not-an-institution", "", institutionOther},
+		{"", "970436", ""},
+	} {
+		if got := institutions.label(tt.institution, tt.bound); got != tt.want {
+			t.Errorf("label(%q, %q) = %q, want %q", tt.institution, tt.bound, got, tt.want)
+		}
+	}
+}
+
+func TestObserveResponseFoldsUnknownInstitutions(t *testing.T) {
+	h := newHarness(t, "gw-1", nil)
+	institutions := NewInstitutions("970400")
+	request := transfer("trace-1", "000001")
+	request.Fields[32] = "123456789"
+	counter := metrics.Responses.WithLabelValues(institutionOther, "970400", "0200", responseCodeApproved)
+	before := testutil.ToFloat64(counter)
+
+	observeResponse(h.cfg, institutions, h.session, request, domain.NewResponse(request, responseCodeApproved))
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("responses from an unknown acquirer counted %v times as other, want 1", got)
+	}
+
+	h.session.BindAcquirer("123456789")
+	bound := metrics.Responses.WithLabelValues("123456789", "970400", "0200", responseCodeApproved)
+	before = testutil.ToFloat64(bound)
+	observeResponse(h.cfg, institutions, h.session, request, domain.NewResponse(request, responseCodeApproved))
+	if got := testutil.ToFloat64(bound) - before; got != 1 {
+		t.Fatalf("responses from the bound acquirer counted %v times, want 1", got)
+	}
+}
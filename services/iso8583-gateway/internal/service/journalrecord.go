@@ -0,0 +1,82 @@
+package service
+
+import (
+	"encoding/json"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/publisher"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// journalRecord is the journal entry of a transaction published on
+// APP_JOURNAL_TOPIC, keyed by trace ID, with the request or dead letter
+// record it describes. It carries no card data.
+type journalRecord struct {
+	TraceID    string    `json:"trace_id"`
+	Status     string    `json:"status"`
+	Topic      string    `json:"topic"`
+	MTI        string    `json:"mti"`
+	STAN       string    `json:"stan"`
+	RRN        string    `json:"rrn"`
+	Acquirer   string    `json:"acquirer"`
+	ServiceID  string    `json:"service_id"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// journalRecords returns the journal record of v published to topic with
+// status, or none when APP_JOURNAL_TOPIC is not set.
+func (service *InboundService) journalRecords(v *domain.ISO8583Message, f63 string, topic string, status string) []*publisher.Message {
+	cfg := service.applicationConfig
+	if cfg.JournalTopic == "" {
+		return nil
+	}
+	value, err := json.Marshal(&journalRecord{
+		TraceID:    f63,
+		Status:     status,
+		Topic:      topic,
+		MTI:        v.MTI,
+		STAN:       v.Fields[11],
+		RRN:        v.Fields[37],
+		Acquirer:   v.Fields[32],
+		ServiceID:  cfg.ServiceID,
+		ReceivedAt: v.ReceivedAt,
+	})
+	if err != nil {
+		zap.L().Error("Failed to serialize journal record", zap.Error(err), zap.String("f63", f63))
+		return nil
+	}
+	return []*publisher.Message{{
+		Topic: cfg.JournalTopic,
+		Key:   f63,
+		Value: value,
+		Headers: []publisher.Header{
+			{Key: "service_id", Value: cfg.ServiceID},
+			{Key: "trace_id", Value: f63},
+		},
+	}}
+}
+
+// publishWith publishes msg with the records that go with it. A
+// transactional sink commits them in one transaction, so they are published
+// all together or not at all. Other sinks publish the side effects after msg,
+// and their failure is logged without failing msg.
+func publishWith(p publisher.Publisher, msg *publisher.Message, sideEffects []*publisher.Message) (publisher.Receipt, error) {
+	if t, ok := p.(publisher.Transactional); ok && t.Transactional() {
+		receipts, err := t.PublishTransaction(append([]*publisher.Message{msg}, sideEffects...))
+		if err != nil {
+			return publisher.Receipt{}, err
+		}
+		return receipts[0], nil
+	}
+	receipt, err := p.Publish(msg)
+	if err != nil {
+		return receipt, err
+	}
+	for _, sideEffect := range sideEffects {
+		if _, err := p.Publish(sideEffect); err != nil {
+			zap.L().Error("Failed to publish record", zap.Error(err), zap.String("topic", sideEffect.Topic), zap.String("key", sideEffect.Key))
+		}
+	}
+	return receipt, nil
+}
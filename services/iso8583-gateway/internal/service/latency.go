@@ -0,0 +1,35 @@
+package service
+
+import (
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/session"
+	"iso8583-gateway/pkg/metrics"
+	"time"
+)
+
+// observeResponse counts a response written to s and, when the request it
+// answers is known, records how long the request waited for it. The labels
+// come from the request, or from the response when the request is unknown.
+func observeResponse(cfg *config.ApplicationConfig, institutions *Institutions, s *session.Session, request *domain.ISO8583Message, response *domain.ISO8583Message) {
+	source := request
+	if source == nil {
+		source = response
+	}
+	acquirer := institutions.label(source.Fields[32], s.Acquirer())
+	receiver := institutions.label(source.Fields[100], "")
+	mti := domain.RequestMTI(source.MTI)
+	metrics.Responses.WithLabelValues(acquirer, receiver, mti, response.Fields[39]).Inc()
+	if request == nil || request.ReceivedAt.IsZero() {
+		return
+	}
+	transactionType := ""
+	if pc, err := request.ProcessingCode(); err == nil {
+		transactionType = pc.TransactionType
+	}
+	latency := time.Since(request.ReceivedAt)
+	metrics.ResponseLatency.WithLabelValues(acquirer, receiver, mti, transactionType).Observe(latency.Seconds())
+	if latency > cfg.LatencySLA {
+		metrics.SLABreaches.WithLabelValues(acquirer, receiver, mti, transactionType).Inc()
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"iso8583-gateway/internal/config"
+
+	"golang.org/x/time/rate"
+)
+
+// ListenerPolicy is what the inbound pipeline applies per listener: its own
+// routes, its rate limit shared by all its sessions, and its access control.
+type ListenerPolicy struct {
+	Name                      string
+	Routes                    []config.Route
+	MaxSessionsPerInstitution int
+	BindAcquirer              bool
+	limiter                   *rate.Limiter
+}
+
+func NewListenerPolicy(cfg *config.ListenerConfig) *ListenerPolicy {
+	policy := &ListenerPolicy{
+		Name:                      cfg.Name,
+		Routes:                    cfg.Routes,
+		MaxSessionsPerInstitution: cfg.MaxSessionsPerInstitution,
+		BindAcquirer:              cfg.BindAcquirer,
+	}
+	if cfg.RateLimit > 0 {
+		burst := cfg.RateBurst
+		if burst <= 0 {
+			burst = max(1, int(cfg.RateLimit))
+		}
+		policy.limiter = rate.NewLimiter(rate.Limit(cfg.RateLimit), burst)
+	}
+	return policy
+}
+
+// allow reports whether one more message fits in the rate limit.
+func (policy *ListenerPolicy) allow() bool {
+	return policy.limiter == nil || policy.limiter.Allow()
+}
+
+// matchRoute returns the first listener route matching the message.
+func (policy *ListenerPolicy) matchRoute(mti string, processingCode string, institution string) (config.Route, bool) {
+	for _, route := range policy.Routes {
+		if route.Matches(mti, processingCode, institution) {
+			return route, true
+		}
+	}
+	return config.Route{}, false
+}
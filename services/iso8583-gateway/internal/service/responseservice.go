@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/correlation"
+	"iso8583-gateway/internal/dedupe"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/journal"
+	"iso8583-gateway/internal/publisher"
+	"iso8583-gateway/internal/session"
+	"iso8583-gateway/pkg/contract"
+	"iso8583-gateway/pkg/tracing"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	maxForwardHops = 1
+
+	responseCodeApproved = "00"
+	responseCodeTimeout  = "68"
+)
+
+// ResponseService reads the backend responses addressed to this instance and
+// writes them to the session that serves the institution. Responses whose
+// session moved to another instance are forwarded to it.
+type ResponseService struct {
+	ctx               context.Context
+	applicationConfig *config.ApplicationConfig
+	publisher         publisher.Publisher
+	subscriber        publisher.Subscriber
+	sessions          *session.Registry
+	directory         *SessionDirectory
+	correlations      *correlation.Store
+	reversals         *ReversalService
+	dedupes           *dedupe.Store
+	journal           *journal.Journal
+	institutions      *Institutions
+}
+
+func NewResponseService(ctx context.Context, applicationConfig *config.ApplicationConfig, publisher publisher.Publisher, subscriber publisher.Subscriber, sessions *session.Registry, directory *SessionDirectory, correlations *correlation.Store, reversals *ReversalService, dedupes *dedupe.Store, j *journal.Journal, institutions *Institutions) *ResponseService {
+	return &ResponseService{
+		ctx:               ctx,
+		applicationConfig: applicationConfig,
+		publisher:         publisher,
+		subscriber:        subscriber,
+		sessions:          sessions,
+		directory:         directory,
+		correlations:      correlations,
+		reversals:         reversals,
+		dedupes:           dedupes,
+		journal:           j,
+		institutions:      institutions,
+	}
+}
+
+func (service *ResponseService) ProcessResponse() {
+	topic := service.applicationConfig.InboundResponseTopic
+	if service.subscriber == nil {
+		zap.L().Warn("No subscriber, responses are not read", zap.String("topic", topic))
+		return
+	}
+	partitions, err := service.subscriber.Partitions(topic)
+	if err != nil {
+		zap.L().Error("Fail to get response topic partitions", zap.String("topic", topic), zap.Error(err))
+		return
+	}
+	if service.applicationConfig.ResponseRouting != config.ResponseRoutingShared {
+		// The backend keys responses by service_id, so only one partition can hold ours.
+		owned, err := service.subscriber.Partition(topic, service.applicationConfig.ServiceID)
+		if err != nil {
+			zap.L().Error("Fail to get owned response partition", zap.String("topic", topic), zap.Error(err))
+			return
+		}
+		partitions = []int32{owned}
+	}
+	zap.L().Info("Consuming responses", zap.String("topic", topic), zap.String("routing", service.applicationConfig.ResponseRouting), zap.Int32s("partitions", partitions))
+	err = service.subscriber.Subscribe(service.ctx, topic, partitions, false, service.processResponse)
+	if err != nil {
+		zap.L().Error("Fail to consume responses", zap.String("topic", topic), zap.Error(err))
+	}
+}
+
+func (service *ResponseService) processResponse(msg *publisher.Record) {
+	serviceID := msg.Header("service_id")
+	if serviceID != service.applicationConfig.ServiceID {
+		return
+	}
+	start := time.Now()
+	traceID := msg.Header("trace_id")
+	response, err := contract.UnmarshalResponse(msg.Header("content-type"), msg.Header("schema"), msg.Value)
+	if err != nil {
+		zap.L().Error("Failed to unmarshal response message", zap.Error(err), zap.String("trace_id", traceID))
+		return
+	}
+	v := domain.NewISO8583Message(domain.ResponseMTI(response.MTI), response.Fields)
+	if service.reversals.Acknowledge(traceID, v) {
+		return
+	}
+	entry, err := service.correlations.Match(traceID, v)
+	// The backend may not propagate the trace context, in which case the
+	// response joins the trace of the request it answers.
+	parent := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier{&msg.Headers})
+	if err == nil && !trace.SpanContextFromContext(parent).IsValid() {
+		parent = entry.Request.TraceContext()
+	}
+	ctx, span := tracing.Tracer().Start(parent, "response.match",
+		trace.WithTimestamp(start),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("messaging.source.name", msg.Topic), attribute.String("iso8583.mti", v.MTI), attribute.String("iso8583.trace_id", traceID)),
+	)
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+	}
+	v.Context = ctx
+	var request *domain.ISO8583Message
+	switch {
+	case err == nil:
+		traceID = entry.TraceID
+		request = entry.Request
+		if s, ok := service.sessions.Get(entry.SessionID); ok {
+			service.write(s, request, v, traceID, journal.StatusResponded)
+			return
+		}
+	case errors.Is(err, correlation.ErrDuplicateResponse), errors.Is(err, correlation.ErrLateResponse):
+		zap.L().Warn("Reject response", zap.Error(err), zap.String("trace_id", traceID), zap.String("key", entry.Key))
+		return
+	}
+	// The request came in on a session that is gone, or on another instance
+	// before the session moved here: deliver to whoever serves the institution.
+	institution := v.Fields[32]
+	if s, ok := service.sessions.Lookup(institution); ok {
+		service.write(s, request, v, traceID, journal.StatusResponded)
+		return
+	}
+	service.forward(msg, institution, traceID)
+}
+
+// ProcessTimeout answers an expired request on the backend's behalf, so the
+// acquirer isn't left waiting for a response that may never come, and
+// reverses it if it may have moved money.
+func (service *ResponseService) ProcessTimeout(entry *correlation.Entry) {
+	if service.subscriber == nil {
+		// No response is ever read without a subscriber, so an expired request
+		// says nothing about the backend: neither answer 68 nor reverse it.
+		zap.L().Debug("Request expired without response subscriber", zap.String("trace_id", entry.TraceID), zap.String("key", entry.Key))
+		return
+	}
+	zap.L().Warn("Request timed out waiting for backend response", zap.String("trace_id", entry.TraceID), zap.String("key", entry.Key), zap.String("mti", entry.Request.MTI), zap.Duration("timeout", entry.Timeout))
+	service.reversals.Reverse(entry)
+	response := domain.NewResponse(entry.Request, responseCodeTimeout)
+	s, ok := service.sessions.Get(entry.SessionID)
+	if !ok {
+		zap.L().Warn("Drop timeout response without live session", zap.String("session_id", entry.SessionID), zap.String("trace_id", entry.TraceID))
+		service.journalResponse(entry.TraceID, response, nil, journal.StatusTimedOut)
+		return
+	}
+	service.write(s, entry.Request, response, entry.TraceID, journal.StatusTimedOut)
+}
+
+// write sends a response to the session. request is the request it answers,
+// or nil when the request was received elsewhere.
+func (service *ResponseService) write(s *session.Session, request *domain.ISO8583Message, v *domain.ISO8583Message, traceID string, status string) {
+	_, span := tracing.Tracer().Start(v.TraceContext(), "response.write",
+		trace.WithAttributes(attribute.String("gateway.session_id", s.ID), attribute.String("iso8583.mti", v.MTI), attribute.String("iso8583.response_code", v.Fields[39]), attribute.String("gateway.status", status)),
+	)
+	defer span.End()
+	raw, err := s.Write(v)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "write failed")
+		zap.L().Error("Failed to write response to session", zap.Error(err), zap.String("session_id", s.ID), zap.String("trace_id", traceID))
+		return
+	}
+	service.dedupes.SetResponse(dedupe.Key(v), v)
+	observeResponse(service.applicationConfig, service.institutions, s, request, v)
+	service.journalResponse(traceID, v, raw, status)
+	zap.L().Info("Successfully wrote response to session", zap.String("session_id", s.ID), zap.String("remote_addr", s.RemoteAddr), zap.String("mti", v.MTI), zap.String("f39", v.Fields[39]), zap.String("trace_id", traceID))
+}
+
+func (service *ResponseService) journalResponse(traceID string, v *domain.ISO8583Message, raw []byte, status string) {
+	response, err := service.journal.NewMessage(v, raw, time.Now())
+	if err != nil {
+		zap.L().Error("Failed to prepare response for journal", zap.Error(err), zap.String("trace_id", traceID))
+		return
+	}
+	err = service.journal.Update(traceID, func(t *journal.Transaction) {
+		t.Response = response
+		// A reversal may already have been started for a timed out transfer.
+		if t.Status != journal.StatusReversalPending && t.Status != journal.StatusReversed {
+			t.Status = status
+		}
+	})
+	if err != nil {
+		// Responses forwarded from another instance have their request journaled there.
+		zap.L().Warn("Failed to journal response", zap.Error(err), zap.String("trace_id", traceID))
+	}
+}
+
+func (service *ResponseService) forward(msg *publisher.Record, institution string, traceID string) {
+	owner, ok := service.directory.Owner(institution)
+	if !ok || owner == service.applicationConfig.ServiceID {
+		zap.L().Warn("Drop response without live session", zap.String("institution", institution), zap.String("trace_id", traceID))
+		return
+	}
+	hops, _ := strconv.Atoi(msg.Header("forward_hops"))
+	if hops >= maxForwardHops {
+		zap.L().Warn("Drop response exceeding forward hops", zap.String("institution", institution), zap.String("owner", owner), zap.Int("hops", hops), zap.String("trace_id", traceID))
+		return
+	}
+	headers := make([]publisher.Header, 0, len(msg.Headers)+3)
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case "service_id", "forwarded_by", "forward_hops":
+			continue
+		}
+		headers = append(headers, h)
+	}
+	headers = append(headers,
+		publisher.Header{Key: "service_id", Value: owner},
+		publisher.Header{Key: "forwarded_by", Value: service.applicationConfig.ServiceID},
+		publisher.Header{Key: "forward_hops", Value: strconv.Itoa(hops + 1)},
+	)
+	forwarded := &publisher.Message{
+		Topic:   msg.Topic,
+		Key:     owner,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+	receipt, err := service.publisher.Publish(forwarded)
+	if err != nil {
+		zap.L().Error("Failed to forward response", zap.Error(err), zap.String("owner", owner), zap.String("trace_id", traceID))
+		return
+	}
+	zap.L().Info("Forwarded response to session owner", zap.String("institution", institution), zap.String("owner", owner), zap.String("trace_id", traceID), zap.Int64("offset", receipt.Offset), zap.Int32("partition", receipt.Partition))
+}
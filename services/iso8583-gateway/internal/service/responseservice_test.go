@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"iso8583-gateway/internal/correlation"
+	"iso8583-gateway/internal/publisher"
+	"testing"
+	"time"
+)
+
+// idleSubscriber stands in for a response source that never delivers.
+type idleSubscriber struct{}
+
+func (idleSubscriber) Partitions(string) ([]int32, error) {
+	return []int32{0}, nil
+}
+
+func (idleSubscriber) Partition(string, string) (int32, error) {
+	return 0, nil
+}
+
+func (idleSubscriber) Subscribe(ctx context.Context, _ string, _ []int32, _ bool, _ func(*publisher.Record)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func header(headers []publisher.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func TestTimeoutAnswersAndReversesTransfer(t *testing.T) {
+	h := newHarness(t, "gw-1", idleSubscriber{})
+	request := transfer("trace-1", "000001")
+	go h.responses.ProcessTimeout(correlation.NewEntry("trace-1", h.session.ID, request, time.Second))
+
+	response := h.receive()
+	if response.MTI != "0210" || response.Fields[39] != responseCodeTimeout {
+		t.Errorf("got %s F39 %q, want 0210 F39 %q", response.MTI, response.Fields[39], responseCodeTimeout)
+	}
+	reversals := h.pub.Messages(h.cfg.ReversalTopic)
+	if len(reversals) != 1 {
+		t.Fatalf("got %d reversal advices, want 1", len(reversals))
+	}
+	if got := header(reversals[0].Headers, "original_trace_id"); got != "trace-1" {
+		t.Errorf("reversal original_trace_id = %q, want trace-1", got)
+	}
+}
+
+// Without a response source every request would time out, so timeouts must
+// neither answer for the backend nor reverse.
+func TestTimeoutWithoutSubscriber(t *testing.T) {
+	h := newHarness(t, "gw-1", nil)
+	request := transfer("trace-1", "000001")
+	h.responses.ProcessTimeout(correlation.NewEntry("trace-1", h.session.ID, request, time.Second))
+
+	h.expectSilence()
+	if published := h.pub.Messages(""); len(published) != 0 {
+		t.Errorf("got %d published messages, want none", len(published))
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/correlation"
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/journal"
+	"iso8583-gateway/internal/publisher"
+	"iso8583-gateway/internal/reversal"
+	"iso8583-gateway/pkg/contract"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	mtiReversalAdvice       = "0420"
+	mtiReversalAdviceRepeat = "0421"
+	mtiReversalAdviceAck    = "0430"
+
+	processingCodeTransfer = "91"
+)
+
+// reversalFields are the fields of the original transfer carried over to its reversal advice.
+var reversalFields = []int{2, 3, 4, 11, 32, 33, 37, 41, 49, 100, 102, 103}
+
+// ReversalService reverses transfers whose outcome is unknown because the
+// backend didn't answer within the SLA. It sends an 0420 reversal advice to
+// the backend and repeats it as 0421 until an 0430 arrives. Pending reversals
+// are persisted so they are resumed after a restart.
+type ReversalService struct {
+	ctx               context.Context
+	applicationConfig *config.ApplicationConfig
+	publisher         publisher.Publisher
+	store             *reversal.FileStore
+	journal           *journal.Journal
+	serializer        contract.Serializer
+}
+
+func NewReversalService(ctx context.Context, applicationConfig *config.ApplicationConfig, publisher publisher.Publisher, store *reversal.FileStore, j *journal.Journal, serializer contract.Serializer) *ReversalService {
+	return &ReversalService{
+		ctx:               ctx,
+		applicationConfig: applicationConfig,
+		publisher:         publisher,
+		store:             store,
+		journal:           j,
+		serializer:        serializer,
+	}
+}
+
+// ProcessReversal resends unacknowledged reversal advices until ctx is done.
+func (service *ReversalService) ProcessReversal() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-service.ctx.Done():
+			zap.L().Info("Context is done, stopping reversal service")
+			return
+		case now := <-ticker.C:
+			for _, p := range service.store.List() {
+				if now.Sub(p.LastSentAt) >= service.applicationConfig.ReversalRetryInterval {
+					service.send(p)
+				}
+			}
+		}
+	}
+}
+
+// Reverse starts reversing a timed out transfer. Requests other than 0200
+// transfers carry no money movement and are ignored.
+func (service *ReversalService) Reverse(entry *correlation.Entry) {
+	original := entry.Request
+	if original.MTI != "0200" || !strings.HasPrefix(original.Fields[3], processingCodeTransfer) {
+		return
+	}
+	fields := make(map[int]string, len(reversalFields)+4)
+	for _, i := range reversalFields {
+		if f, ok := original.Fields[i]; ok {
+			fields[i] = f
+		}
+	}
+	traceID := uuid.NewString()
+	fields[7] = time.Now().UTC().Format("0102150405")
+	fields[39] = responseCodeTimeout
+	fields[63] = traceID
+	fields[90] = domain.NewOriginalDataElements(original).String()
+	p := &reversal.Pending{
+		TraceID:         traceID,
+		OriginalTraceID: entry.TraceID,
+		Message:         domain.NewISO8583Message(mtiReversalAdvice, fields),
+		CreatedAt:       time.Now(),
+		LastSentAt:      time.Now(),
+	}
+	zap.L().Info("Reversing timed out transfer", zap.String("trace_id", traceID), zap.String("original_trace_id", entry.TraceID), zap.String("f90", fields[90]))
+	if err := service.store.Save(p); err != nil {
+		zap.L().Error("Failed to persist pending reversal", zap.Error(err), zap.String("trace_id", traceID), zap.String("original_trace_id", entry.TraceID))
+	}
+	service.setOriginalStatus(entry.TraceID, journal.StatusReversalPending)
+	service.send(p)
+}
+
+// Acknowledge settles the pending reversal a 0430 response belongs to. It
+// reports whether the response acknowledged a reversal of the gateway's own;
+// any other 0430 answers a partner's reversal and is correlated as usual.
+func (service *ReversalService) Acknowledge(traceID string, v *domain.ISO8583Message) bool {
+	if v.MTI != mtiReversalAdviceAck {
+		return false
+	}
+	p, ok := service.store.Get(traceID)
+	if !ok {
+		p, ok = service.store.FindByOriginal(v.Fields[90])
+	}
+	if !ok {
+		return false
+	}
+	if err := service.store.Delete(p.TraceID); err != nil {
+		zap.L().Error("Failed to remove acknowledged reversal", zap.Error(err), zap.String("trace_id", p.TraceID))
+	}
+	service.setOriginalStatus(p.OriginalTraceID, journal.StatusReversed)
+	zap.L().Info("Reversal acknowledged", zap.String("trace_id", p.TraceID), zap.String("original_trace_id", p.OriginalTraceID), zap.String("f39", v.Fields[39]), zap.Int("attempts", p.Attempts))
+	return true
+}
+
+func (service *ReversalService) send(p *reversal.Pending) {
+	next := *p
+	next.Message = domain.NewISO8583Message(mtiReversalAdvice, p.Message.Fields)
+	if next.Attempts > 0 {
+		next.Message.MTI = mtiReversalAdviceRepeat
+	}
+	next.Attempts++
+	next.LastSentAt = time.Now()
+
+	envelope := domain.NewEnvelope(next.Message, p.TraceID, service.applicationConfig.ServiceID, "", "", false)
+	bytes, err := service.serializer.Marshal(envelope)
+	if err != nil {
+		zap.L().Error("Failed to serialize reversal advice", zap.Error(err), zap.String("trace_id", p.TraceID))
+		return
+	}
+	msg := &publisher.Message{
+		Topic: service.applicationConfig.ReversalTopic,
+		Value: bytes,
+		Headers: append([]publisher.Header{
+			{Key: "service_id", Value: service.applicationConfig.ServiceID},
+			{Key: "trace_id", Value: p.TraceID},
+			{Key: "original_trace_id", Value: p.OriginalTraceID},
+		}, envelopeHeaders(envelope, service.serializer, service.applicationConfig, cloudEventSource(service.applicationConfig.ServiceID, "", ""))...),
+	}
+	receipt, err := service.publisher.Publish(msg)
+	if err != nil {
+		zap.L().Error("Failed to publish reversal advice", zap.Error(err), zap.String("trace_id", p.TraceID), zap.Int("attempt", next.Attempts))
+	} else {
+		zap.L().Info("Successfully published reversal advice", zap.String("mti", next.Message.MTI), zap.String("trace_id", p.TraceID), zap.Int("attempt", next.Attempts), zap.Int64("offset", receipt.Offset), zap.Int32("partition", receipt.Partition))
+	}
+	if _, err := service.store.Update(&next); err != nil {
+		zap.L().Error("Failed to persist pending reversal", zap.Error(err), zap.String("trace_id", p.TraceID))
+	}
+}
+
+func (service *ReversalService) setOriginalStatus(originalTraceID string, status string) {
+	err := service.journal.Update(originalTraceID, func(t *journal.Transaction) {
+		t.Status = status
+	})
+	if err != nil {
+		zap.L().Error("Failed to journal reversal status", zap.Error(err), zap.String("original_trace_id", originalTraceID), zap.String("status", status))
+	}
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"iso8583-gateway/internal/correlation"
+	"iso8583-gateway/internal/domain"
+	"testing"
+	"time"
+)
+
+// A partner's own reversal is answered by the backend with an 0430 that must
+// reach the partner, not be taken for an acknowledgement of a gateway
+// reversal.
+func TestPartnerReversalResponse(t *testing.T) {
+	h := newHarness(t, "gw-1", idleSubscriber{})
+	original := transfer("trace-1", "000001")
+	reversal := domain.NewISO8583Message("0420", map[int]string{
+		3:   original.Fields[3],
+		4:   original.Fields[4],
+		7:   "1019093115",
+		11:  "000002",
+		32:  original.Fields[32],
+		37:  original.Fields[37],
+		63:  "trace-2",
+		90:  domain.NewOriginalDataElements(original).String(),
+		100: original.Fields[100],
+	})
+	reversal.ReceivedAt = time.Now()
+	h.inbound.processInbound(reversal)
+	if published := h.pub.Messages(h.cfg.ReversalTopic); len(published) != 1 {
+		t.Fatalf("got %d reversals published, want 1", len(published))
+	}
+
+	go h.responses.processResponse(responseRecord(t, "gw-1", "trace-2", reversal, responseCodeApproved))
+	response := h.receive()
+	if response.MTI != "0430" || response.Fields[11] != "000002" || response.Fields[39] != responseCodeApproved {
+		t.Errorf("got %s F11 %q F39 %q, want 0430 F11 000002 F39 00", response.MTI, response.Fields[11], response.Fields[39])
+	}
+}
+
+// The acknowledgement of a reversal the gateway sent settles it and is not
+// written to the partner.
+func TestGatewayReversalAcknowledgement(t *testing.T) {
+	h := newHarness(t, "gw-1", idleSubscriber{})
+	request := transfer("trace-1", "000001")
+	go h.responses.ProcessTimeout(correlation.NewEntry("trace-1", h.session.ID, request, time.Second))
+	h.receive()
+	advices := h.pub.Messages(h.cfg.ReversalTopic)
+	if len(advices) != 1 {
+		t.Fatalf("got %d reversal advices, want 1", len(advices))
+	}
+	traceID := header(advices[0].Headers, "trace_id")
+	advice := domain.NewISO8583Message("0420", map[int]string{11: request.Fields[11], 32: request.Fields[32], 63: traceID})
+
+	h.responses.processResponse(responseRecord(t, "gw-1", traceID, advice, responseCodeApproved))
+	h.expectSilence()
+	if _, ok := h.reversals.store.Get(traceID); ok {
+		t.Errorf("reversal %s is still pending after its acknowledgement", traceID)
+	}
+}
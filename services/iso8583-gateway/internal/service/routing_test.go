@@ -0,0 +1,142 @@
+package service
+
+import (
+	"iso8583-gateway/infra/kafka"
+	"iso8583-gateway/internal/publisher"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+const responsePartitions = 3
+
+// instance is a gateway replica reading the directory and its own response
+// partition from mocked Kafka partitions.
+type instance struct {
+	*harness
+	directoryPartition *mocks.PartitionConsumer
+	responsePartition  *mocks.PartitionConsumer
+	wg                 sync.WaitGroup
+}
+
+func newInstance(t *testing.T, serviceID string) *instance {
+	t.Helper()
+	consumer := mocks.NewConsumer(t, nil)
+	cfg := testConfig(serviceID)
+	consumer.SetTopicMetadata(map[string][]int32{
+		cfg.SessionDirectoryTopic: {0},
+		cfg.InboundResponseTopic:  {0, 1, 2},
+	})
+	owned := kafka.PartitionForKey(serviceID, responsePartitions)
+	i := &instance{
+		directoryPartition: consumer.ExpectConsumePartition(cfg.SessionDirectoryTopic, 0, sarama.OffsetOldest),
+		responsePartition:  consumer.ExpectConsumePartition(cfg.InboundResponseTopic, owned, sarama.OffsetNewest),
+	}
+	i.harness = newHarness(t, serviceID, kafka.NewSubscriber(consumer))
+	i.wg.Add(2)
+	go func() {
+		defer i.wg.Done()
+		i.directory.ProcessDirectory()
+	}()
+	go func() {
+		defer i.wg.Done()
+		i.responses.ProcessResponse()
+	}()
+	return i
+}
+
+func (i *instance) stop() {
+	i.cancel()
+	i.wg.Wait()
+}
+
+func consumerMessage(msg publisher.Message) *sarama.ConsumerMessage {
+	record := &sarama.ConsumerMessage{Topic: msg.Topic, Key: []byte(msg.Key), Value: msg.Value}
+	for _, h := range msg.Headers {
+		record.Headers = append(record.Headers, &sarama.RecordHeader{Key: []byte(h.Key), Value: []byte(h.Value)})
+	}
+	return record
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// A response reaching an instance that no longer holds the session is
+// forwarded through Kafka to the instance the directory names as owner.
+func TestResponseForwardedToSessionOwner(t *testing.T) {
+	a := newInstance(t, "gw-a")
+	defer a.stop()
+	b := newInstance(t, "gw-b")
+	defer b.stop()
+	if a.responsePartition == b.responsePartition {
+		t.Fatal("instances share a response partition")
+	}
+
+	// The partner reconnects to b, which announces it on the directory topic.
+	b.sessions.Bind(b.session, "970436", 0)
+	b.directory.Announce("970436")
+	announcements := b.pub.Messages(b.cfg.SessionDirectoryTopic)
+	if len(announcements) != 1 {
+		t.Fatalf("got %d directory entries, want 1", len(announcements))
+	}
+	a.directoryPartition.YieldMessage(consumerMessage(announcements[0]))
+	waitFor(t, "a to learn the owner of 970436", func() bool {
+		owner, ok := a.directory.Owner("970436")
+		return ok && owner == "gw-b"
+	})
+
+	request := transfer("trace-1", "000001")
+	backend := responseRecord(t, "gw-a", "trace-1", request, responseCodeApproved)
+	a.responsePartition.YieldMessage(consumerMessage(publisher.Message{Topic: backend.Topic, Value: backend.Value, Headers: backend.Headers}))
+	var forwarded []publisher.Message
+	waitFor(t, "a to forward the response", func() bool {
+		forwarded = a.pub.Messages(a.cfg.InboundResponseTopic)
+		return len(forwarded) == 1
+	})
+	for key, want := range map[string]string{"service_id": "gw-b", "forwarded_by": "gw-a", "forward_hops": "1", "trace_id": "trace-1"} {
+		if got := header(forwarded[0].Headers, key); got != want {
+			t.Errorf("forwarded header %s = %q, want %q", key, got, want)
+		}
+	}
+	if forwarded[0].Key != "gw-b" {
+		t.Errorf("forwarded key = %q, want gw-b", forwarded[0].Key)
+	}
+
+	b.responsePartition.YieldMessage(consumerMessage(forwarded[0]))
+	response := b.receive()
+	if response.MTI != "0210" || response.Fields[11] != "000001" || response.Fields[39] != responseCodeApproved {
+		t.Errorf("got %s F11 %q F39 %q, want 0210 F11 000001 F39 00", response.MTI, response.Fields[11], response.Fields[39])
+	}
+	a.expectSilence()
+}
+
+// An instance ignores responses addressed to another one, and a forwarded
+// response is not forwarded again.
+func TestResponseForwardingStops(t *testing.T) {
+	a := newInstance(t, "gw-a")
+	defer a.stop()
+	a.directory.update("970436", directoryEntry{ServiceID: "gw-b", Active: true})
+	request := transfer("trace-1", "000001")
+
+	other := responseRecord(t, "gw-b", "trace-1", request, responseCodeApproved)
+	a.responses.processResponse(other)
+	forwardedOnce := responseRecord(t, "gw-a", "trace-1", request, responseCodeApproved)
+	forwardedOnce.Headers = append(forwardedOnce.Headers, publisher.Header{Key: "forward_hops", Value: "1"})
+	a.responses.processResponse(forwardedOnce)
+
+	if published := a.pub.Messages(""); len(published) != 0 {
+		t.Errorf("got %d published messages, want none", len(published))
+	}
+	a.expectSilence()
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/publisher"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type directoryEntry struct {
+	ServiceID string    `json:"service_id"`
+	Active    bool      `json:"active"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SessionDirectory shares which gateway instance currently holds a session for
+// each institution. Every instance announces its own institutions on a
+// compacted topic and reads everyone else's, so a response for a session that
+// moved to another pod can be forwarded there.
+type SessionDirectory struct {
+	ctx               context.Context
+	applicationConfig *config.ApplicationConfig
+	publisher         publisher.Publisher
+	subscriber        publisher.Subscriber
+	mu                sync.RWMutex
+	owners            map[string]string
+}
+
+func NewSessionDirectory(ctx context.Context, applicationConfig *config.ApplicationConfig, publisher publisher.Publisher, subscriber publisher.Subscriber) *SessionDirectory {
+	return &SessionDirectory{
+		ctx:               ctx,
+		applicationConfig: applicationConfig,
+		publisher:         publisher,
+		subscriber:        subscriber,
+		owners:            make(map[string]string),
+	}
+}
+
+func (directory *SessionDirectory) ProcessDirectory() {
+	topic := directory.applicationConfig.SessionDirectoryTopic
+	if directory.subscriber == nil {
+		zap.L().Warn("No subscriber, only local sessions are known", zap.String("topic", topic))
+		return
+	}
+	partitions, err := directory.subscriber.Partitions(topic)
+	if err != nil {
+		zap.L().Error("Fail to get session directory partitions", zap.String("topic", topic), zap.Error(err))
+		return
+	}
+	err = directory.subscriber.Subscribe(directory.ctx, topic, partitions, true, directory.apply)
+	if err != nil {
+		zap.L().Error("Fail to consume session directory", zap.String("topic", topic), zap.Error(err))
+	}
+}
+
+// Owner returns the service ID of the instance holding a session for institution.
+func (directory *SessionDirectory) Owner(institution string) (string, bool) {
+	directory.mu.RLock()
+	defer directory.mu.RUnlock()
+	owner, ok := directory.owners[institution]
+	return owner, ok
+}
+
+func (directory *SessionDirectory) Announce(institution string) {
+	directory.publish(institution, true)
+}
+
+func (directory *SessionDirectory) Withdraw(institution string) {
+	directory.publish(institution, false)
+}
+
+func (directory *SessionDirectory) publish(institution string, active bool) {
+	entry := directoryEntry{
+		ServiceID: directory.applicationConfig.ServiceID,
+		Active:    active,
+		UpdatedAt: time.Now().UTC(),
+	}
+	directory.update(institution, entry)
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		zap.L().Error("Failed to marshal session directory entry", zap.Error(err), zap.String("institution", institution))
+		return
+	}
+	msg := &publisher.Message{
+		Topic: directory.applicationConfig.SessionDirectoryTopic,
+		Key:   institution,
+		Value: bytes,
+	}
+	if _, err := directory.publisher.Publish(msg); err != nil {
+		zap.L().Error("Failed to publish session directory entry", zap.Error(err), zap.String("institution", institution), zap.Bool("active", active))
+		return
+	}
+	zap.L().Info("Published session directory entry", zap.String("institution", institution), zap.Bool("active", active))
+}
+
+func (directory *SessionDirectory) apply(msg *publisher.Record) {
+	var entry directoryEntry
+	if err := json.Unmarshal(msg.Value, &entry); err != nil {
+		zap.L().Warn("Ignore malformed session directory entry", zap.Error(err), zap.ByteString("key", msg.Key))
+		return
+	}
+	directory.update(string(msg.Key), entry)
+}
+
+func (directory *SessionDirectory) update(institution string, entry directoryEntry) {
+	directory.mu.Lock()
+	defer directory.mu.Unlock()
+	if entry.Active {
+		directory.owners[institution] = entry.ServiceID
+		return
+	}
+	// Only the current owner may withdraw, so a late withdrawal from the old
+	// pod doesn't erase the announcement of the pod the session moved to.
+	if directory.owners[institution] == entry.ServiceID {
+		delete(directory.owners, institution)
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"iso8583-gateway/internal/publisher"
+)
+
+// headerCarrier lets the trace context propagator write W3C headers to a
+// message about to be published, and read them from a consumed record.
+type headerCarrier struct {
+	headers *[]publisher.Header
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key string, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = value
+			return
+		}
+	}
+	*c.headers = append(*c.headers, publisher.Header{Key: key, Value: value})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"iso8583-gateway/internal/domain"
+	"iso8583-gateway/internal/handler"
+	"iso8583-gateway/internal/profile"
+	"net"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Session is a TCP connection from a partner. Responses for the requests read
+// from the connection are written back through it.
+type Session struct {
+	ID         string
+	RemoteAddr string
+	writer     *handler.ISO8583Writer
+	mu         sync.Mutex
+	acquirer   string
+}
+
+func NewSession(conn net.Conn, selection *profile.Selection, framing handler.Framing) *Session {
+	return &Session{
+		ID:         uuid.NewString(),
+		RemoteAddr: conn.RemoteAddr().String(),
+		writer:     handler.NewISO8583Writer(conn, selection, framing),
+	}
+}
+
+// Write sends msg to the peer and returns the packed message.
+func (s *Session) Write(msg *domain.ISO8583Message) ([]byte, error) {
+	return s.writer.Write(msg)
+}
+
+// BindAcquirer binds the session to acquirer unless it is already bound, and
+// returns the acquirer the session is bound to.
+func (s *Session) BindAcquirer(acquirer string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.acquirer == "" {
+		s.acquirer = acquirer
+	}
+	return s.acquirer
+}
+
+// Acquirer returns the acquirer ID the session is bound to, if any.
+func (s *Session) Acquirer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acquirer
+}
+
+func (s *Session) WriteRaw(data []byte) error {
+	return s.writer.WriteRaw(data)
+}
+
+// Registry tracks the sessions held by this gateway instance and which of
+// them currently serves each institution.
+type Registry struct {
+	mu            sync.RWMutex
+	sessions      map[string]*Session
+	institutions  map[string][]*Session
+	bySessionInst map[string]map[string]struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		sessions:      make(map[string]*Session),
+		institutions:  make(map[string][]*Session),
+		bySessionInst: make(map[string]map[string]struct{}),
+	}
+}
+
+func (r *Registry) Add(s *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[s.ID] = s
+	r.bySessionInst[s.ID] = make(map[string]struct{})
+}
+
+// Bind records that institution sends through s. It reports whether this is
+// the first local session serving the institution, and false for allowed
+// when the institution already holds limit other sessions. Zero is no limit.
+func (r *Registry) Bind(s *Session, institution string, limit int) (first bool, allowed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bound, ok := r.bySessionInst[s.ID]
+	if !ok {
+		return false, true
+	}
+	if _, ok := bound[institution]; ok {
+		return false, true
+	}
+	if limit > 0 && len(r.institutions[institution]) >= limit {
+		return false, false
+	}
+	bound[institution] = struct{}{}
+	r.institutions[institution] = append(r.institutions[institution], s)
+	return len(r.institutions[institution]) == 1, true
+}
+
+// Remove drops s and returns the institutions left without any local session.
+func (r *Registry) Remove(s *Session) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var released []string
+	for institution := range r.bySessionInst[s.ID] {
+		remaining := r.institutions[institution][:0]
+		for _, other := range r.institutions[institution] {
+			if other.ID != s.ID {
+				remaining = append(remaining, other)
+			}
+		}
+		if len(remaining) == 0 {
+			delete(r.institutions, institution)
+			released = append(released, institution)
+			continue
+		}
+		r.institutions[institution] = remaining
+	}
+	delete(r.bySessionInst, s.ID)
+	delete(r.sessions, s.ID)
+	return released
+}
+
+func (r *Registry) Get(id string) (*Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sessions[id]
+	return s, ok
+}
+
+// Lookup returns the most recently bound local session serving institution.
+func (r *Registry) Lookup(institution string) (*Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sessions := r.institutions[institution]
+	if len(sessions) == 0 {
+		return nil, false
+	}
+	return sessions[len(sessions)-1], true
+}
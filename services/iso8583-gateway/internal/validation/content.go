@@ -0,0 +1,82 @@
+package validation
+
+import (
+	"iso8583-gateway/pkg/element"
+	"time"
+)
+
+const (
+	ViolationNumeric   = "numeric"
+	ViolationPrintable = "printable"
+	ViolationLuhn      = "luhn"
+	ViolationDate      = "date"
+	ViolationCurrency  = "currency"
+	ViolationCountry   = "country"
+)
+
+// numericFields are the fields the spec defines as n. F28 is x+n and is left out.
+var numericFields = map[int]bool{
+	2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 9: true, 10: true,
+	11: true, 12: true, 13: true, 14: true, 15: true, 18: true, 19: true, 22: true,
+	23: true, 25: true, 32: true, 33: true, 49: true, 50: true, 51: true, 66: true,
+	67: true, 70: true, 71: true, 72: true, 90: true, 100: true,
+}
+
+// binaryFields hold key material or chip data, which may be in any charset.
+var binaryFields = map[int]bool{52: true, 55: true, 128: true}
+
+// checkContent returns the kind of violation and the reason when value is not
+// valid content for field n.
+func checkContent(n int, value string) (string, string) {
+	if binaryFields[n] {
+		return "", ""
+	}
+	if numericFields[n] {
+		if !element.IsNumeric(value) {
+			return ViolationNumeric, "must be numeric"
+		}
+	} else if !printable(value) {
+		return ViolationPrintable, "must be printable ASCII"
+	}
+	switch n {
+	case 2:
+		if !element.LuhnValid(value) {
+			return ViolationLuhn, "fails the Luhn check"
+		}
+	case 7:
+		if !validDate("0102150405", value) {
+			return ViolationDate, "must be a valid MMDDhhmmss"
+		}
+	case 13, 15:
+		if !validDate("0102", value) {
+			return ViolationDate, "must be a valid MMDD"
+		}
+	case 19:
+		if _, ok := element.LookupCountry(value); !ok {
+			return ViolationCountry, "must be an ISO 3166 numeric country code"
+		}
+	case 49, 50, 51:
+		if _, ok := element.LookupCurrency(value); !ok {
+			return ViolationCurrency, "must be an ISO 4217 numeric currency code"
+		}
+	}
+	return "", ""
+}
+
+func printable(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < 0x20 || value[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// validDate parses value in a leap year, so 29 February is accepted.
+func validDate(layout string, value string) bool {
+	if len(value) != len(layout) {
+		return false
+	}
+	_, err := time.Parse("2006"+layout, "2000"+value)
+	return err == nil
+}
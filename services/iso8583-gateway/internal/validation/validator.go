@@ -0,0 +1,198 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"os"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ViolationMissing     = "missing"
+	ViolationConditional = "conditional"
+	ViolationForbidden   = "forbidden"
+)
+
+// Condition makes Field mandatory when IfPresent is present or when IfAbsent
+// is absent.
+type Condition struct {
+	Field     int `json:"field"`
+	IfPresent int `json:"if_present,omitempty"`
+	IfAbsent  int `json:"if_absent,omitempty"`
+}
+
+// Spec lists the mandatory, conditional and forbidden fields of the messages
+// with an MTI and, optionally, a processing code prefix.
+type Spec struct {
+	Name           string      `json:"name"`
+	MTI            string      `json:"mti"`
+	ProcessingCode string      `json:"processing_code,omitempty"`
+	Mandatory      []int       `json:"mandatory,omitempty"`
+	Conditional    []Condition `json:"conditional,omitempty"`
+	Forbidden      []int       `json:"forbidden,omitempty"`
+}
+
+func (s *Spec) matches(msg *domain.ISO8583Message) bool {
+	return s.MTI == msg.MTI && strings.HasPrefix(msg.Fields[3], s.ProcessingCode)
+}
+
+type file struct {
+	Specs []Spec `json:"specs"`
+}
+
+// Violation is a field of a message that breaks a spec, or whose content is
+// invalid, in which case Spec is empty.
+type Violation struct {
+	Spec   string
+	Field  int
+	Kind   string
+	Reason string
+}
+
+func (v Violation) String() string {
+	if v.Spec == "" {
+		return fmt.Sprintf("F%d %s", v.Field, v.Reason)
+	}
+	return fmt.Sprintf("F%d %s (%s)", v.Field, v.Reason, v.Spec)
+}
+
+// DefaultSpecs are used when no specs file is configured. They cover what the
+// transfer service needs to process a message.
+var DefaultSpecs = []Spec{
+	{
+		Name:      "financial-request",
+		MTI:       "0200",
+		Mandatory: []int{3, 7, 11, 32, 37, 100},
+		Conditional: []Condition{
+			{Field: 50, IfPresent: 5},
+			{Field: 51, IfPresent: 6},
+		},
+		Forbidden: []int{39},
+	},
+	{Name: "transfer", MTI: "0200", ProcessingCode: "91", Mandatory: []int{4, 49, 103}},
+	{Name: "inquiry", MTI: "0200", ProcessingCode: "43", Mandatory: []int{103}},
+	{Name: "reversal", MTI: "0420", Mandatory: []int{3, 4, 7, 11, 32, 37, 90, 100}, Forbidden: []int{39}},
+	{Name: "reversal-repeat", MTI: "0421", Mandatory: []int{3, 4, 7, 11, 32, 37, 90, 100}, Forbidden: []int{39}},
+	{Name: "network-management", MTI: "0800", Mandatory: []int{7, 11, 70}},
+}
+
+// Validator checks messages against every spec that matches them and, unless
+// disabled, checks the content of every field.
+type Validator struct {
+	specs   []Spec
+	content bool
+}
+
+// Load reads the specs file, or uses DefaultSpecs without one. A disabled
+// validator accepts every message.
+func Load(cfg *config.ValidationConfig) (*Validator, error) {
+	if !cfg.Enabled {
+		return &Validator{}, nil
+	}
+	if cfg.File == "" {
+		return &Validator{specs: DefaultSpecs, content: cfg.Content}, nil
+	}
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("read validation file: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse validation file %s: %w", cfg.File, err)
+	}
+	for i := range f.Specs {
+		if err := check(&f.Specs[i]); err != nil {
+			return nil, fmt.Errorf("spec %q: %w", f.Specs[i].Name, err)
+		}
+	}
+	zap.L().Info("Loaded validation specs", zap.String("file", cfg.File), zap.Int("specs", len(f.Specs)))
+	return &Validator{specs: f.Specs, content: cfg.Content}, nil
+}
+
+func check(s *Spec) error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(s.MTI) != 4 {
+		return fmt.Errorf("mti must be 4 characters, got %q", s.MTI)
+	}
+	fields := append(append([]int{}, s.Mandatory...), s.Forbidden...)
+	for _, c := range s.Conditional {
+		if (c.IfPresent == 0) == (c.IfAbsent == 0) {
+			return fmt.Errorf("condition on F%d needs exactly one of if_present and if_absent", c.Field)
+		}
+		fields = append(fields, c.Field, c.IfPresent+c.IfAbsent)
+	}
+	for _, n := range fields {
+		if n < 2 || n > 128 {
+			return fmt.Errorf("field %d out of range 2-128", n)
+		}
+	}
+	return nil
+}
+
+// Validate returns the violations of a message: those of the specs, in spec
+// order, then those of the field contents, in field order.
+func (validator *Validator) Validate(msg *domain.ISO8583Message) []Violation {
+	var violations []Violation
+	for i := range validator.specs {
+		s := &validator.specs[i]
+		if !s.matches(msg) {
+			continue
+		}
+		for _, n := range s.Mandatory {
+			if !present(msg, n) {
+				violations = append(violations, Violation{Spec: s.Name, Field: n, Kind: ViolationMissing, Reason: "is mandatory"})
+			}
+		}
+		for _, c := range s.Conditional {
+			if present(msg, c.Field) {
+				continue
+			}
+			if c.IfPresent != 0 && present(msg, c.IfPresent) {
+				violations = append(violations, Violation{Spec: s.Name, Field: c.Field, Kind: ViolationConditional, Reason: fmt.Sprintf("is mandatory when F%d is present", c.IfPresent)})
+			}
+			if c.IfAbsent != 0 && !present(msg, c.IfAbsent) {
+				violations = append(violations, Violation{Spec: s.Name, Field: c.Field, Kind: ViolationConditional, Reason: fmt.Sprintf("is mandatory when F%d is absent", c.IfAbsent)})
+			}
+		}
+		for _, n := range s.Forbidden {
+			if present(msg, n) {
+				violations = append(violations, Violation{Spec: s.Name, Field: n, Kind: ViolationForbidden, Reason: "is not allowed"})
+			}
+		}
+	}
+	if validator.content {
+		violations = append(violations, validateContent(msg)...)
+	}
+	return violations
+}
+
+func validateContent(msg *domain.ISO8583Message) []Violation {
+	fields := make([]int, 0, len(msg.Fields))
+	for n := range msg.Fields {
+		fields = append(fields, n)
+	}
+	slices.Sort(fields)
+	var violations []Violation
+	for _, n := range fields {
+		value := msg.Fields[n]
+		if value == "" {
+			continue
+		}
+		if kind, reason := checkContent(n, value); kind != "" {
+			violations = append(violations, Violation{Field: n, Kind: kind, Reason: reason})
+		}
+	}
+	return violations
+}
+
+func present(msg *domain.ISO8583Message, n int) bool {
+	return msg.Fields[n] != ""
+}
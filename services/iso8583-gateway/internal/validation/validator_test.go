@@ -0,0 +1,159 @@
+package validation
+
+import (
+	"iso8583-gateway/internal/config"
+	"iso8583-gateway/internal/domain"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// transfer is a 0200 fund transfer that satisfies DefaultSpecs.
+func transfer() map[int]string {
+	return map[int]string{
+		2:   "9704366614952070",
+		3:   "912000",
+		4:   "000001500000",
+		7:   "1019093015",
+		11:  "000123",
+		32:  "970436",
+		37:  "629209000123",
+		49:  "704",
+		100: "970400",
+		103: "0123456789",
+	}
+}
+
+func with(fields map[int]string, changes map[int]string) map[int]string {
+	for n, value := range changes {
+		if value == "" {
+			delete(fields, n)
+			continue
+		}
+		fields[n] = value
+	}
+	return fields
+}
+
+func violations(list []Violation) string {
+	s := make([]string, len(list))
+	for i, v := range list {
+		s[i] = v.Kind + ":" + v.String()
+	}
+	return strings.Join(s, "; ")
+}
+
+func TestValidateSpecs(t *testing.T) {
+	validator, err := Load(&config.ValidationConfig{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name   string
+		mti    string
+		fields map[int]string
+		want   string
+	}{
+		{"valid transfer", "0200", transfer(), ""},
+		{"transfer without account", "0200", with(transfer(), map[int]string{103: ""}), "missing:F103 is mandatory (transfer)"},
+		{"missing STAN and amount", "0200", with(transfer(), map[int]string{11: "", 4: ""}), "missing:F11 is mandatory (financial-request); missing:F4 is mandatory (transfer)"},
+		{"settlement amount without currency", "0200", with(transfer(), map[int]string{5: "000001500000"}), "conditional:F50 is mandatory when F5 is present (financial-request)"},
+		{"settlement amount with currency", "0200", with(transfer(), map[int]string{5: "000001500000", 50: "704"}), ""},
+		{"request with response code", "0200", with(transfer(), map[int]string{39: "00"}), "forbidden:F39 is not allowed (financial-request)"},
+		{"inquiry needs no amount", "0200", with(transfer(), map[int]string{3: "430000", 4: "", 49: ""}), ""},
+		{"reversal without F90", "0420", transfer(), "missing:F90 is mandatory (reversal)"},
+		{"echo without network management code", "0800", map[int]string{7: "1019093015", 11: "000001"}, "missing:F70 is mandatory (network-management)"},
+		{"no spec for MTI", "0100", map[int]string{}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violations(validator.Validate(domain.NewISO8583Message(tt.mti, tt.fields)))
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	for _, tt := range []struct {
+		field int
+		value string
+		want  string
+	}{
+		{2, "9704366614952070", ""},
+		{2, "9704366614952079", ViolationLuhn},
+		{3, "91200A", ViolationNumeric},
+		{7, "1019093015", ""},
+		{7, "1332093015", ViolationDate},
+		{13, "0229", ""},
+		{15, "0230", ViolationDate},
+		{19, "704", ""},
+		{19, "999", ViolationCountry},
+		{49, "704", ""},
+		{49, "999", ViolationCurrency},
+		{28, "C00000100", ""},
+		{41, "ATM\x0001", ViolationPrintable},
+		{52, "\x01\x02\xff", ""},
+	} {
+		kind, _ := checkContent(tt.field, tt.value)
+		if kind != tt.want {
+			t.Errorf("F%d %q: got %q, want %q", tt.field, tt.value, kind, tt.want)
+		}
+	}
+}
+
+func TestValidateContentDisabled(t *testing.T) {
+	fields := with(transfer(), map[int]string{49: "999"})
+	for _, tt := range []struct {
+		cfg  config.ValidationConfig
+		want int
+	}{
+		{config.ValidationConfig{Enabled: true, Content: true}, 1},
+		{config.ValidationConfig{Enabled: true}, 0},
+		{config.ValidationConfig{Content: true}, 0},
+	} {
+		validator, err := Load(&tt.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := validator.Validate(domain.NewISO8583Message("0200", fields)); len(got) != tt.want {
+			t.Errorf("%+v: got %d violations %q, want %d", tt.cfg, len(got), violations(got), tt.want)
+		}
+	}
+}
+
+func TestLoadSpecsFile(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		json string
+		err  string
+	}{
+		{"if absent", `{"specs": [{"name": "pos", "mti": "0200", "conditional": [{"field": 35, "if_absent": 2}]}]}`, ""},
+		{"no name", `{"specs": [{"mti": "0200"}]}`, "name is required"},
+		{"short MTI", `{"specs": [{"name": "x", "mti": "200"}]}`, "mti must be 4 characters"},
+		{"both conditions", `{"specs": [{"name": "x", "mti": "0200", "conditional": [{"field": 35, "if_present": 2, "if_absent": 45}]}]}`, "exactly one of"},
+		{"field out of range", `{"specs": [{"name": "x", "mti": "0200", "mandatory": [129]}]}`, "out of range"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "validation.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			validator, err := Load(&config.ValidationConfig{Enabled: true, File: path})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := violations(validator.Validate(domain.NewISO8583Message("0200", map[int]string{})))
+			if want := "conditional:F35 is mandatory when F2 is absent (pos)"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
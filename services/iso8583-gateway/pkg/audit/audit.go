@@ -0,0 +1,9 @@
+package audit
+
+import "go.uber.org/zap"
+
+// Record writes an audit trail event. Audit events go through the "audit"
+// logger so they can be shipped and retained separately from operational logs.
+func Record(event string, fields ...zap.Field) {
+	zap.L().Named("audit").Info(event, append(fields, zap.String("audit_event", event))...)
+}
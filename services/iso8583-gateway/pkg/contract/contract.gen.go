@@ -0,0 +1,38 @@
+// Code generated by avro/gen. DO NOT EDIT.
+package contract
+
+import (
+	"time"
+)
+
+// Institution is a generated struct.
+type Institution struct {
+	AcquirerID  string `avro:"acquirer_id" json:"acquirer_id"`
+	ForwarderID string `avro:"forwarder_id" json:"forwarder_id"`
+	ReceiverID  string `avro:"receiver_id" json:"receiver_id"`
+}
+
+// A request, reversal or advice received from a partner, as published by the gateway.
+type InboundRequest struct {
+	SchemaVersion int    `avro:"schema_version" json:"schema_version"`
+	MTI           string `avro:"mti" json:"mti"`
+	// Field values keyed by field number.
+	Fields      map[string]string `avro:"fields" json:"fields"`
+	NamedFields map[string]string `avro:"named_fields" json:"named_fields"`
+	TraceID     string            `avro:"trace_id" json:"trace_id"`
+	ReceivedAt  time.Time         `avro:"received_at" json:"received_at"`
+	GatewayID   string            `avro:"gateway_id" json:"gateway_id"`
+	SessionID   string            `avro:"session_id" json:"session_id"`
+	RemoteAddr  string            `avro:"remote_addr" json:"remote_addr"`
+	Institution Institution       `avro:"institution" json:"institution"`
+	Raw         *[]byte           `avro:"raw" json:"raw"`
+	// Spec profile the message was parsed with.
+	Profile string `avro:"profile" json:"profile"`
+}
+
+// The backend's answer to an InboundRequest, with F39 set.
+type InboundResponse struct {
+	MTI string `avro:"mti" json:"mti"`
+	// Field values keyed by field number.
+	Fields map[string]string `avro:"fields" json:"fields"`
+}
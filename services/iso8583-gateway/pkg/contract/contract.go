@@ -0,0 +1,197 @@
+// Package contract holds the schemas of the records exchanged with the
+// backend over Kafka, and the Go types generated from them.
+package contract
+
+//go:generate go tool avrogen -pkg contract -o contract.gen.go -tags json:snake -initialisms MTI registry/inbound-request/v2.avsc registry/inbound-response/v1.avsc
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+const (
+	SubjectInboundRequest  = "inbound-request"
+	SubjectInboundResponse = "inbound-response"
+
+	FormatJSON = "json"
+	FormatAvro = "avro"
+
+	ContentTypeAvro = "application/avro"
+)
+
+//go:embed registry
+var embedded embed.FS
+
+// Embedded returns the registry compiled into the binary.
+func Embedded() *Registry {
+	sub, err := fs.Sub(embedded, "registry")
+	if err != nil {
+		panic(err)
+	}
+	return NewRegistry(sub)
+}
+
+var embeddedVersions = sync.OnceValues(func() (map[string]Version, error) {
+	registry := Embedded()
+	subjects, err := registry.Subjects()
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]Version)
+	for _, subject := range subjects {
+		list, err := registry.Versions(subject)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list {
+			versions[v.ID()] = v
+		}
+		versions[subject] = list[len(list)-1]
+	}
+	return versions, nil
+})
+
+// lookup returns the embedded version with the given ID, or the latest
+// version of subject when id is empty.
+func lookup(subject string, id string) (Version, error) {
+	versions, err := embeddedVersions()
+	if err != nil {
+		return Version{}, err
+	}
+	if id == "" {
+		id = subject
+	}
+	v, ok := versions[id]
+	if !ok || v.Subject != subject {
+		return Version{}, fmt.Errorf("unknown %s schema %q", subject, id)
+	}
+	return v, nil
+}
+
+// Serializer encodes the envelopes published for inbound messages.
+type Serializer interface {
+	ContentType() string
+	// SchemaID is the registry version the payload is written with, or "".
+	SchemaID() string
+	Marshal(e *Envelope) ([]byte, error)
+}
+
+// NewSerializer returns the serializer for format: json, or avro with the
+// latest registered inbound-request schema.
+func NewSerializer(format string) (Serializer, error) {
+	switch format {
+	case "", FormatJSON:
+		return jsonSerializer{}, nil
+	case FormatAvro:
+		version, err := lookup(SubjectInboundRequest, "")
+		if err != nil {
+			return nil, err
+		}
+		return &avroSerializer{version: version}, nil
+	}
+	return nil, fmt.Errorf("unsupported serializer %q, expected json or avro", format)
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) ContentType() string {
+	return EnvelopeContentType
+}
+
+func (jsonSerializer) SchemaID() string {
+	return ""
+}
+
+func (jsonSerializer) Marshal(e *Envelope) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+type avroSerializer struct {
+	version Version
+}
+
+func (s *avroSerializer) ContentType() string {
+	return ContentTypeAvro
+}
+
+func (s *avroSerializer) SchemaID() string {
+	return s.version.ID()
+}
+
+func (s *avroSerializer) Marshal(e *Envelope) ([]byte, error) {
+	return avro.Marshal(s.version.Schema, NewInboundRequest(e))
+}
+
+func NewInboundRequest(e *Envelope) *InboundRequest {
+	request := &InboundRequest{
+		SchemaVersion: e.SchemaVersion,
+		MTI:           e.MTI,
+		Fields:        stringKeys(e.Fields),
+		NamedFields:   e.NamedFields,
+		TraceID:       e.TraceID,
+		ReceivedAt:    e.ReceivedAt,
+		GatewayID:     e.GatewayID,
+		SessionID:     e.SessionID,
+		RemoteAddr:    e.RemoteAddr,
+		Profile:       e.Profile,
+		Institution: Institution{
+			AcquirerID:  e.Institution.AcquirerID,
+			ForwarderID: e.Institution.ForwarderID,
+			ReceiverID:  e.Institution.ReceiverID,
+		},
+	}
+	if e.Raw != nil {
+		request.Raw = &e.Raw
+	}
+	return request
+}
+
+// Response is a backend response to an inbound request.
+type Response struct {
+	MTI    string         `json:"mti"`
+	Fields map[int]string `json:"fields"`
+}
+
+// UnmarshalResponse decodes a backend response written as JSON, or as Avro
+// when contentType says so, with the schema version named by schemaID, or the
+// latest one.
+func UnmarshalResponse(contentType string, schemaID string, data []byte) (*Response, error) {
+	if contentType != ContentTypeAvro {
+		var v Response
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return &v, nil
+	}
+	version, err := lookup(SubjectInboundResponse, schemaID)
+	if err != nil {
+		return nil, err
+	}
+	var response InboundResponse
+	if err := avro.Unmarshal(version.Schema, data, &response); err != nil {
+		return nil, err
+	}
+	fields := make(map[int]string, len(response.Fields))
+	for k, f := range response.Fields {
+		i, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field number %q", k)
+		}
+		fields[i] = f
+	}
+	return &Response{MTI: response.MTI, Fields: fields}, nil
+}
+
+func stringKeys(fields map[int]string) map[string]string {
+	m := make(map[string]string, len(fields))
+	for i, f := range fields {
+		m[strconv.Itoa(i)] = f
+	}
+	return m
+}
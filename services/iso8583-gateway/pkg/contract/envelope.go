@@ -0,0 +1,97 @@
+package contract
+
+import "time"
+
+const (
+	EnvelopeSchemaVersion = 1
+	EnvelopeContentType   = "application/json"
+)
+
+// Envelope is the JSON published for a message. MTI and Fields stay at the
+// top level, where consumers of the bare message read them, but the other
+// keys are new to those consumers: a consumer must ignore unknown keys to
+// read the envelope. testdata/envelope.json is the fixture the
+// transfer-service checks its DTO against.
+type Envelope struct {
+	SchemaVersion int                 `json:"schema_version"`
+	MTI           string              `json:"mti"`
+	Fields        map[int]string      `json:"fields"`
+	NamedFields   map[string]string   `json:"named_fields"`
+	TraceID       string              `json:"trace_id"`
+	ReceivedAt    time.Time           `json:"received_at"`
+	GatewayID     string              `json:"gateway_id"`
+	SessionID     string              `json:"session_id,omitempty"`
+	RemoteAddr    string              `json:"remote_addr,omitempty"`
+	Institution   EnvelopeInstitution `json:"institution"`
+	// Raw is the frame the message was parsed from, base64 encoded, when
+	// raw frames are published.
+	Raw []byte `json:"raw,omitempty"`
+	// Profile is the spec profile the message was parsed with.
+	Profile string `json:"profile,omitempty"`
+}
+
+// EnvelopeInstitution identifies the parties of a message: the acquirer (F32), the
+// forwarder (F33) and the receiving institution (F100).
+type EnvelopeInstitution struct {
+	AcquirerID  string `json:"acquirer_id,omitempty"`
+	ForwarderID string `json:"forwarder_id,omitempty"`
+	ReceiverID  string `json:"receiver_id,omitempty"`
+}
+
+// NamedFields returns the fields with a defined meaning under their envelope
+// names, e.g. F2 as "pan".
+func NamedFields(fields map[int]string) map[string]string {
+	named := make(map[string]string, len(fields))
+	for i, f := range fields {
+		if name, ok := fieldNames[i]; ok {
+			named[name] = f
+		}
+	}
+	return named
+}
+
+// fieldNames are the envelope names of the fields with a defined meaning.
+var fieldNames = map[int]string{
+	2:   "pan",
+	3:   "processing_code",
+	4:   "amount_transaction",
+	5:   "amount_settlement",
+	6:   "amount_cardholder_billing",
+	7:   "transmission_date_time",
+	9:   "conversion_rate_settlement",
+	10:  "conversion_rate_cardholder_billing",
+	11:  "stan",
+	12:  "local_time",
+	13:  "local_date",
+	14:  "expiration_date",
+	15:  "settlement_date",
+	18:  "merchant_type",
+	19:  "acquiring_country_code",
+	22:  "pos_entry_mode",
+	23:  "card_sequence_number",
+	25:  "pos_condition_code",
+	28:  "amount_fee",
+	32:  "acquiring_institution_id",
+	33:  "forwarding_institution_id",
+	37:  "rrn",
+	38:  "authorization_id",
+	39:  "response_code",
+	41:  "terminal_id",
+	42:  "merchant_id",
+	43:  "card_acceptor_name",
+	48:  "additional_data",
+	49:  "currency_code_transaction",
+	50:  "currency_code_settlement",
+	51:  "currency_code_cardholder",
+	54:  "additional_amounts",
+	63:  "trace_id",
+	66:  "settlement_code",
+	70:  "network_management_code",
+	90:  "original_data_elements",
+	95:  "replacement_amounts",
+	100: "receiving_institution_id",
+	102: "account_id_1",
+	103: "account_id_2",
+	104: "transaction_description",
+	128: "mac",
+}
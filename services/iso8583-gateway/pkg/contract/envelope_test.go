@@ -0,0 +1,54 @@
+package contract
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// envelopeFixture is the envelope the transfer-service contract test
+// (ISO8583MessageContractTest) reads. Keep the two in step: a change to the
+// envelope fails this test until the fixture is updated, and the fixture is
+// what the Java DTO is checked against.
+const envelopeFixture = "testdata/envelope.json"
+
+func TestEnvelopeMatchesFixture(t *testing.T) {
+	serializer, err := NewSerializer(FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[int]string{2: "9704361234567890", 3: "912000", 4: "000000150000", 11: "000123", 32: "970436", 41: "ATM00001", 63: "trace-1", 100: "970415"}
+	data, err := serializer.Marshal(&Envelope{
+		SchemaVersion: EnvelopeSchemaVersion,
+		MTI:           "0200",
+		Fields:        fields,
+		NamedFields:   NamedFields(fields),
+		TraceID:       "trace-1",
+		ReceivedAt:    time.Date(2026, 10, 19, 8, 15, 30, 0, time.UTC),
+		GatewayID:     "gw-1",
+		SessionID:     "session-1",
+		RemoteAddr:    "10.0.0.12:40522",
+		Institution:   EnvelopeInstitution{AcquirerID: "970436", ReceiverID: "970415"},
+		Profile:       "napas",
+		Raw:           []byte("0200frame"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := os.ReadFile(envelopeFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(fixture, &want); err != nil {
+		t.Fatalf("parse %s: %v", envelopeFixture, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("published envelope no longer matches %s:\n got %s", envelopeFixture, data)
+	}
+}
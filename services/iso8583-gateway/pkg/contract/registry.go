@@ -0,0 +1,128 @@
+package contract
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hamba/avro/v2"
+)
+
+// Version is one registered schema of a subject.
+type Version struct {
+	Subject string
+	Number  int
+	Schema  avro.Schema
+}
+
+// ID names the version in record headers, e.g. "inbound-request/v1".
+func (v Version) ID() string {
+	return v.Subject + "/v" + strconv.Itoa(v.Number)
+}
+
+// Registry is a file-based stand-in for a schema registry: one directory per
+// subject, holding v1.avsc, v2.avsc, ... Versions are immutable once
+// released; a change is a new file.
+type Registry struct {
+	fsys fs.FS
+}
+
+func NewRegistry(fsys fs.FS) *Registry {
+	return &Registry{fsys: fsys}
+}
+
+// Subjects lists the subjects of the registry.
+func (r *Registry) Subjects() ([]string, error) {
+	entries, err := fs.ReadDir(r.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var subjects []string
+	for _, e := range entries {
+		if e.IsDir() {
+			subjects = append(subjects, e.Name())
+		}
+	}
+	return subjects, nil
+}
+
+// Versions returns the versions of a subject, oldest first.
+func (r *Registry) Versions(subject string) ([]Version, error) {
+	entries, err := fs.ReadDir(r.fsys, subject)
+	if err != nil {
+		return nil, fmt.Errorf("read subject %s: %w", subject, err)
+	}
+	var versions []Version
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".avsc") {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".avsc"))
+		if err != nil {
+			return nil, fmt.Errorf("subject %s: unexpected schema file %s", subject, name)
+		}
+		data, err := fs.ReadFile(r.fsys, path.Join(subject, name))
+		if err != nil {
+			return nil, err
+		}
+		schema, err := avro.ParseBytesWithCache(data, "", &avro.SchemaCache{})
+		if err != nil {
+			return nil, fmt.Errorf("parse %s/%s: %w", subject, name, err)
+		}
+		versions = append(versions, Version{Subject: subject, Number: number, Schema: schema})
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("subject %s has no versions", subject)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Number < versions[j].Number })
+	for i, v := range versions {
+		if v.Number != i+1 {
+			return nil, fmt.Errorf("subject %s: missing version v%d", subject, i+1)
+		}
+	}
+	return versions, nil
+}
+
+// Latest returns the newest version of a subject.
+func (r *Registry) Latest(subject string) (Version, error) {
+	versions, err := r.Versions(subject)
+	if err != nil {
+		return Version{}, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Check verifies that every version of every subject is fully compatible
+// with all the versions before it: data written with either schema can be
+// read with the other, so producers and consumers can upgrade in any order.
+func (r *Registry) Check() error {
+	subjects, err := r.Subjects()
+	if err != nil {
+		return err
+	}
+	compatibility := avro.NewSchemaCompatibility()
+	var errs []error
+	for _, subject := range subjects {
+		versions, err := r.Versions(subject)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for i, newer := range versions {
+			for _, older := range versions[:i] {
+				if err := compatibility.Compatible(newer.Schema, older.Schema); err != nil {
+					errs = append(errs, fmt.Errorf("%s can't read %s: %w", newer.ID(), older.ID(), err))
+				}
+				if err := compatibility.Compatible(older.Schema, newer.Schema); err != nil {
+					errs = append(errs, fmt.Errorf("%s can't read %s: %w", older.ID(), newer.ID(), err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
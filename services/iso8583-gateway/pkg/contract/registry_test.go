@@ -0,0 +1,101 @@
+package contract
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// TestEmbeddedRegistryCompatible runs the check of cmd/schemacheck on the
+// registry compiled into the gateway.
+func TestEmbeddedRegistryCompatible(t *testing.T) {
+	if err := Embedded().Check(); err != nil {
+		t.Fatalf("schema registry is not compatible:\n%v", err)
+	}
+}
+
+func TestCheckRejectsIncompatibleVersion(t *testing.T) {
+	registry := NewRegistry(fstest.MapFS{
+		"subject/v1.avsc": {Data: []byte(`{"type": "record", "name": "R", "fields": [{"name": "a", "type": "string"}]}`)},
+		// A field without a default can't be read from v1 data.
+		"subject/v2.avsc": {Data: []byte(`{"type": "record", "name": "R", "fields": [{"name": "a", "type": "string"}, {"name": "b", "type": "string"}]}`)},
+	})
+	err := registry.Check()
+	if err == nil || !strings.Contains(err.Error(), "subject/v2 can't read subject/v1") {
+		t.Fatalf("Check() = %v, want v2 unable to read v1", err)
+	}
+}
+
+func TestCheckRejectsMissingVersion(t *testing.T) {
+	registry := NewRegistry(fstest.MapFS{
+		"subject/v1.avsc": {Data: []byte(`"string"`)},
+		"subject/v3.avsc": {Data: []byte(`"string"`)},
+	})
+	if err := registry.Check(); err == nil || !strings.Contains(err.Error(), "missing version v2") {
+		t.Fatalf("Check() = %v, want missing v2", err)
+	}
+}
+
+// Consumers still on an older schema version read requests written with the
+// latest one.
+func TestOlderVersionsReadLatestRequests(t *testing.T) {
+	serializer, err := NewSerializer(FormatAvro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := serializer.Marshal(&Envelope{
+		SchemaVersion: EnvelopeSchemaVersion,
+		MTI:           "0200",
+		Fields:        map[int]string{3: "912000", 11: "000123"},
+		TraceID:       "trace-1",
+		ReceivedAt:    time.Date(2026, 10, 19, 8, 15, 30, 0, time.UTC),
+		GatewayID:     "gw-1",
+		Institution:   EnvelopeInstitution{AcquirerID: "970436"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := lookup(SubjectInboundRequest, serializer.SchemaID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := Embedded().Versions(SubjectInboundRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compatibility := avro.NewSchemaCompatibility()
+	for _, v := range versions {
+		schema, err := compatibility.Resolve(v.Schema, latest.Schema)
+		if err != nil {
+			t.Fatalf("%s can't read %s: %v", v.ID(), latest.ID(), err)
+		}
+		var request map[string]any
+		if err := avro.Unmarshal(schema, data, &request); err != nil {
+			t.Fatalf("%s: %v", v.ID(), err)
+		}
+		if request["mti"] != "0200" || request["trace_id"] != "trace-1" {
+			t.Errorf("%s read %v", v.ID(), request)
+		}
+	}
+}
+
+func TestUnmarshalAvroResponse(t *testing.T) {
+	latest, err := lookup(SubjectInboundResponse, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := avro.Marshal(latest.Schema, &InboundResponse{MTI: "0210", Fields: map[string]string{"39": "00", "63": "trace-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := UnmarshalResponse(ContentTypeAvro, latest.ID(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.MTI != "0210" || response.Fields[39] != "00" || response.Fields[63] != "trace-1" {
+		t.Errorf("got %+v", response)
+	}
+}
@@ -0,0 +1,191 @@
+// Package element holds the typed values of ISO 8583 data elements, such as
+// amounts, processing codes and PANs, and their parsers. It has no dependency
+// on the gateway, so Go services consuming the gateway's records can parse
+// their fields the way the gateway does.
+package element
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrFieldMissing = errors.New("field is missing")
+
+// FieldError tells which field a parser failed on.
+type FieldError struct {
+	Field int
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("F%d: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func fieldError(field int, format string, args ...any) error {
+	return &FieldError{Field: field, Err: fmt.Errorf(format, args...)}
+}
+
+func present(field int, value string) error {
+	if value == "" {
+		return &FieldError{Field: field, Err: ErrFieldMissing}
+	}
+	return nil
+}
+
+// Amount is a transaction amount in the minor units of its currency.
+type Amount struct {
+	Minor    int64
+	Currency Currency
+}
+
+// String formats the amount in major units followed by the currency, e.g.
+// "1500000 VND" or "12.50 USD".
+func (a Amount) String() string {
+	digits := strconv.FormatInt(a.Minor, 10)
+	if a.Currency.Exponent > 0 {
+		if len(digits) <= a.Currency.Exponent {
+			digits = strings.Repeat("0", a.Currency.Exponent-len(digits)+1) + digits
+		}
+		point := len(digits) - a.Currency.Exponent
+		digits = digits[:point] + "." + digits[point:]
+	}
+	return digits + " " + a.Currency.Alpha
+}
+
+// ParseAmount parses an F4 amount in the currency of F49.
+func ParseAmount(f4 string, f49 string) (Amount, error) {
+	if err := present(4, f4); err != nil {
+		return Amount{}, err
+	}
+	if len(f4) != 12 || !IsNumeric(f4) {
+		return Amount{}, fieldError(4, "amount must be 12 digits, got %q", f4)
+	}
+	minor, err := strconv.ParseInt(f4, 10, 64)
+	if err != nil {
+		return Amount{}, &FieldError{Field: 4, Err: err}
+	}
+	if err := present(49, f49); err != nil {
+		return Amount{}, err
+	}
+	currency, ok := LookupCurrency(f49)
+	if !ok {
+		return Amount{}, fieldError(49, "unknown ISO 4217 currency code %q", f49)
+	}
+	return Amount{Minor: minor, Currency: currency}, nil
+}
+
+// ParseTransmissionTime parses an MMDDhhmmss value in UTC, in the year that
+// puts it closest to ref, or to now when ref is zero.
+func ParseTransmissionTime(f7 string, ref time.Time) (time.Time, error) {
+	if err := present(7, f7); err != nil {
+		return time.Time{}, err
+	}
+	if len(f7) != 10 || !IsNumeric(f7) {
+		return time.Time{}, fieldError(7, "transmission date and time must be 10 digits MMDDhhmmss, got %q", f7)
+	}
+	if ref.IsZero() {
+		ref = time.Now()
+	}
+	ref = ref.UTC()
+	var best time.Time
+	for _, year := range []int{ref.Year() - 1, ref.Year(), ref.Year() + 1} {
+		t, err := time.Parse("20060102150405", strconv.Itoa(year)+f7)
+		if err != nil {
+			continue
+		}
+		if best.IsZero() || t.Sub(ref).Abs() < best.Sub(ref).Abs() {
+			best = t
+		}
+	}
+	if best.IsZero() {
+		return time.Time{}, fieldError(7, "invalid transmission date and time %q", f7)
+	}
+	return best, nil
+}
+
+// ProcessingCode is F3 split into its sub-elements.
+type ProcessingCode struct {
+	TransactionType string
+	FromAccount     string
+	ToAccount       string
+}
+
+func (p ProcessingCode) String() string {
+	return p.TransactionType + p.FromAccount + p.ToAccount
+}
+
+// ParseProcessingCode parses F3.
+func ParseProcessingCode(f3 string) (ProcessingCode, error) {
+	if err := present(3, f3); err != nil {
+		return ProcessingCode{}, err
+	}
+	if len(f3) != 6 || !IsNumeric(f3) {
+		return ProcessingCode{}, fieldError(3, "processing code must be 6 digits, got %q", f3)
+	}
+	return ProcessingCode{TransactionType: f3[0:2], FromAccount: f3[2:4], ToAccount: f3[4:6]}, nil
+}
+
+// PAN is a primary account number that passed the Luhn check.
+type PAN string
+
+// BIN returns the first 6 digits, the issuer identification number.
+func (p PAN) BIN() string {
+	return string(p[:6])
+}
+
+// Masked keeps the first 6 and last 4 digits.
+func (p PAN) Masked() string {
+	return string(p[:6]) + strings.Repeat("*", len(p)-10) + string(p[len(p)-4:])
+}
+
+// ParsePAN parses F2.
+func ParsePAN(f2 string) (PAN, error) {
+	if err := present(2, f2); err != nil {
+		return "", err
+	}
+	if len(f2) < 12 || len(f2) > 19 || !IsNumeric(f2) {
+		return "", fieldError(2, "PAN must be 12 to 19 digits, got %d characters", len(f2))
+	}
+	if !LuhnValid(f2) {
+		return "", fieldError(2, "PAN fails the Luhn check")
+	}
+	return PAN(f2), nil
+}
+
+// IsNumeric reports whether value is made of ASCII digits only.
+func IsNumeric(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// LuhnValid reports whether a digit string passes the Luhn (mod 10) check.
+func LuhnValid(digits string) bool {
+	if digits == "" || !IsNumeric(digits) {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,80 @@
+package element
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseAmount(t *testing.T) {
+	for _, tt := range []struct {
+		f4, f49 string
+		want    string
+		field   int
+	}{
+		{"000001500000", "704", "1500000 VND", 0},
+		{"000000001250", "840", "12.50 USD", 0},
+		{"000000000005", "048", "0.005 BHD", 0},
+		{"", "704", "", 4},
+		{"15000", "704", "", 4},
+		{"000001500000", "", "", 49},
+		{"000001500000", "999", "", 49},
+	} {
+		amount, err := ParseAmount(tt.f4, tt.f49)
+		if tt.field != 0 {
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field {
+				t.Errorf("ParseAmount(%q, %q) error = %v, want an F%d error", tt.f4, tt.f49, err, tt.field)
+			}
+			continue
+		}
+		if err != nil || amount.String() != tt.want {
+			t.Errorf("ParseAmount(%q, %q) = %s, %v, want %s", tt.f4, tt.f49, amount, err, tt.want)
+		}
+	}
+}
+
+func TestParsePAN(t *testing.T) {
+	pan, err := ParsePAN("9704366614952070")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pan.BIN() != "970436" || pan.Masked() != "970436******2070" {
+		t.Errorf("BIN %s, masked %s", pan.BIN(), pan.Masked())
+	}
+	if _, err := ParsePAN("9704366614952079"); err == nil {
+		t.Error("PAN failing the Luhn check was accepted")
+	}
+	if _, err := ParsePAN(""); !errors.Is(err, ErrFieldMissing) {
+		t.Errorf("missing PAN error = %v, want %v", err, ErrFieldMissing)
+	}
+}
+
+func TestParseTransmissionTime(t *testing.T) {
+	ref := time.Date(2027, 1, 1, 0, 5, 0, 0, time.UTC)
+	got, err := ParseTransmissionTime("1231235959", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %s, want %s across the year boundary", got, want)
+	}
+}
+
+func TestOriginalDataElementsRoundTrip(t *testing.T) {
+	original := &OriginalDataElements{MTI: "0200", STAN: "000123", TransmissionDateTime: "1019093015", AcquirerID: "970436"}
+	f90 := original.String()
+	if len(f90) != 42 {
+		t.Fatalf("F90 %q is %d characters, want 42", f90, len(f90))
+	}
+	parsed, err := ParseOriginalDataElements(f90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *original {
+		t.Errorf("parsed %+v, want %+v", parsed, original)
+	}
+	if _, err := ParseOriginalDataElements(f90[:41]); err == nil {
+		t.Error("41 character F90 was accepted")
+	}
+}
@@ -0,0 +1,48 @@
+package element
+
+import "strings"
+
+// OriginalDataElements is F90 of a reversal or advice: the identifying fields
+// of the transaction it refers to.
+type OriginalDataElements struct {
+	MTI                  string
+	STAN                 string
+	TransmissionDateTime string
+	AcquirerID           string
+	ForwarderID          string
+}
+
+// ParseOriginalDataElements splits a 42 character F90 value into its sub-elements.
+// Institution IDs are returned without their zero padding.
+func ParseOriginalDataElements(f90 string) (*OriginalDataElements, error) {
+	if err := present(90, f90); err != nil {
+		return nil, err
+	}
+	if len(f90) != 42 {
+		return nil, fieldError(90, "original data elements must be 42 characters, got %d", len(f90))
+	}
+	if !IsNumeric(f90) {
+		return nil, fieldError(90, "original data elements must be numeric: %q", f90)
+	}
+	return &OriginalDataElements{
+		MTI:                  f90[0:4],
+		STAN:                 f90[4:10],
+		TransmissionDateTime: f90[10:20],
+		AcquirerID:           strings.TrimLeft(f90[20:31], "0"),
+		ForwarderID:          strings.TrimLeft(f90[31:42], "0"),
+	}, nil
+}
+
+// String formats the elements as the 42 character F90 value:
+// MTI(4) STAN(6) F7(10) F32(11) F33(11), institution IDs right-justified with zeros.
+func (o *OriginalDataElements) String() string {
+	return zeroPad(o.MTI, 4) + zeroPad(o.STAN, 6) + zeroPad(o.TransmissionDateTime, 10) + zeroPad(o.AcquirerID, 11) + zeroPad(o.ForwarderID, 11)
+}
+
+// zeroPad right-justifies value in a fixed width numeric element.
+func zeroPad(value string, width int) string {
+	if len(value) >= width {
+		return value[len(value)-width:]
+	}
+	return strings.Repeat("0", width-len(value)) + value
+}
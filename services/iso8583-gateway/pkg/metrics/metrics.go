@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	DecisionAccepted     = "accepted"
+	DecisionReplayed     = "replayed"
+	DecisionAcknowledged = "acknowledged"
+	DecisionSuppressed   = "suppressed"
+)
+
+var DedupeDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_dedupe_decisions_total",
+	Help: "Inbound requests by duplicate-transmission decision.",
+}, []string{"decision"})
+
+const (
+	RuleModeApplied = "applied"
+	RuleModeDryRun  = "dry_run"
+)
+
+var RuleMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_rule_matches_total",
+	Help: "Inbound messages matched by a rule, by rule, action and whether it was applied or only reported.",
+}, []string{"rule", "action", "mode"})
+
+var ValidationViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_validation_violations_total",
+	Help: "Field violations of rejected inbound messages, by spec, field and kind of violation.",
+}, []string{"spec", "field", "violation"})
+
+var RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_rate_limited_total",
+	Help: "Inbound messages refused over the rate limit of their listener.",
+}, []string{"listener"})
+
+var AccessRefusals = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_access_refusals_total",
+	Help: "Connections and messages refused by the access control of their listener, by reason.",
+}, []string{"listener", "reason"})
+
+var ListenerUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gateway_listener_up",
+	Help: "Whether a listener is accepting connections.",
+}, []string{"listener"})
+
+// LatencyBuckets are tuned for interbank SLAs, where most responses are
+// expected well under a second.
+var LatencyBuckets = []float64{.005, .01, .025, .05, .1, .2, .3, .5, .75, 1, 1.5, 2, 3, 5, 10, 30}
+
+var ResponseLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gateway_response_latency_seconds",
+	Help:    "Time from receiving a request to writing its response, by acquirer (F32), receiving institution (F100), request MTI and transaction type (F3).",
+	Buckets: LatencyBuckets,
+}, []string{"acquirer", "receiver", "mti", "transaction_type"})
+
+var Responses = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_responses_total",
+	Help: "Responses written to sessions, by acquirer (F32), receiving institution (F100), request MTI and response code (F39).",
+}, []string{"acquirer", "receiver", "mti", "response_code"})
+
+var SLABreaches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_sla_breaches_total",
+	Help: "Responses written later than the latency SLA, by acquirer (F32), receiving institution (F100), request MTI and transaction type (F3).",
+}, []string{"acquirer", "receiver", "mti", "transaction_type"})
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
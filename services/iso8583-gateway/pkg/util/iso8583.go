@@ -1,8 +1,10 @@
 package util
 
 import (
+	"encoding/hex"
 	"fmt"
 	"iso8583-gateway/internal/domain"
+	"maps"
 
 	"github.com/moov-io/iso8583"
 	"github.com/moov-io/iso8583/encoding"
@@ -11,8 +13,183 @@ import (
 	"go.uber.org/zap"
 )
 
-func ParseISO8583(data []byte) (*domain.ISO8583Message, error) {
-	message := iso8583.NewMessage(napasSpec)
+const (
+	EncodingASCII  = "ascii"
+	EncodingBCD    = "bcd"
+	EncodingEBCDIC = "ebcdic"
+	EncodingBinary = "binary"
+	EncodingHex    = "hex"
+)
+
+// Encodings tells how a partner encodes each kind of field.
+type Encodings struct {
+	// Numeric is ascii, bcd or ebcdic. It applies to the MTI, the numeric
+	// fields and the length prefixes of variable numeric and binary fields.
+	Numeric string `json:"numeric,omitempty"`
+	// Text is ascii or ebcdic.
+	Text string `json:"text,omitempty"`
+	// Bitmap is binary or hex.
+	Bitmap string `json:"bitmap,omitempty"`
+	// Binary is ascii, for hex characters, or binary. It applies to F52, F55
+	// and F128.
+	Binary string `json:"binary,omitempty"`
+}
+
+// DefaultEncodings are the NAPAS encodings: ASCII fields and a binary bitmap.
+var DefaultEncodings = Encodings{Numeric: EncodingASCII, Text: EncodingASCII, Bitmap: EncodingBinary, Binary: EncodingASCII}
+
+// withDefaults fills the encodings left empty from DefaultEncodings.
+func (e Encodings) withDefaults() Encodings {
+	if e.Numeric == "" {
+		e.Numeric = DefaultEncodings.Numeric
+	}
+	if e.Text == "" {
+		e.Text = DefaultEncodings.Text
+	}
+	if e.Bitmap == "" {
+		e.Bitmap = DefaultEncodings.Bitmap
+	}
+	if e.Binary == "" {
+		e.Binary = DefaultEncodings.Binary
+	}
+	return e
+}
+
+// FieldFormat redefines a field in a partner's dialect.
+type FieldFormat struct {
+	// Kind is numeric, text or binary. It is required for the fields NAPAS
+	// does not define.
+	Kind string `json:"kind,omitempty"`
+	// Length is the fixed or maximum length, in characters, or in hex
+	// characters for binary fields.
+	Length int `json:"length"`
+	// Prefix is fixed, ll or lll. It defaults to that of the NAPAS field.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+var fieldKinds = map[string]fieldKind{"numeric": kindNumeric, "text": kindText, "binary": kindBinary}
+
+var prefixKinds = map[string]prefixKind{"fixed": fixed, "ll": ll, "lll": lll}
+
+// withFormats returns the NAPAS field definitions with formats applied.
+func withFormats(formats map[int]FieldFormat) (map[int]fieldDef, error) {
+	defs := maps.Clone(fieldDefs)
+	for n, format := range formats {
+		if n < 2 || n > 128 || n == 65 {
+			return nil, fmt.Errorf("field %d can't be redefined", n)
+		}
+		def, ok := defs[n]
+		if !ok {
+			def.description = fmt.Sprintf("Field %d", n)
+			if format.Kind == "" {
+				return nil, fmt.Errorf("F%d needs a kind, it is not a NAPAS field", n)
+			}
+		}
+		if format.Kind != "" {
+			if def.kind, ok = fieldKinds[format.Kind]; !ok {
+				return nil, fmt.Errorf("F%d: unknown kind %q, expected numeric, text or binary", n, format.Kind)
+			}
+		}
+		if format.Prefix != "" {
+			if def.prefix, ok = prefixKinds[format.Prefix]; !ok {
+				return nil, fmt.Errorf("F%d: unknown prefix %q, expected fixed, ll or lll", n, format.Prefix)
+			}
+		}
+		if format.Length <= 0 {
+			return nil, fmt.Errorf("F%d: length must be positive", n)
+		}
+		def.length = format.Length
+		defs[n] = def
+	}
+	return defs, nil
+}
+
+// Spec is a message spec built for a set of encodings. Binary fields are
+// carried in ISO8583Message as uppercase hex whatever their encoding, so a
+// message reads the same from every partner.
+type Spec struct {
+	Encodings   Encodings
+	defs        map[int]fieldDef
+	messageSpec *iso8583.MessageSpec
+}
+
+// NewSpec builds the spec of the NAPAS field definitions, redefined by
+// formats, in the given encodings.
+func NewSpec(encodings Encodings, formats map[int]FieldFormat) (*Spec, error) {
+	defs, err := withFormats(formats)
+	if err != nil {
+		return nil, err
+	}
+	encodings = encodings.withDefaults()
+	numeric, ok := numericEncodings[encodings.Numeric]
+	if !ok {
+		return nil, fmt.Errorf("unknown numeric encoding %q, expected ascii, bcd or ebcdic", encodings.Numeric)
+	}
+	text, ok := textEncodings[encodings.Text]
+	if !ok {
+		return nil, fmt.Errorf("unknown text encoding %q, expected ascii or ebcdic", encodings.Text)
+	}
+	if encodings.Binary != EncodingASCII && encodings.Binary != EncodingBinary {
+		return nil, fmt.Errorf("unknown binary encoding %q, expected ascii or binary", encodings.Binary)
+	}
+	var bitmap field.Field
+	switch encodings.Bitmap {
+	case EncodingBinary:
+		bitmap = field.NewBitmap(&field.Spec{Length: 8, Description: "Bitmap", Enc: encoding.Binary, Pref: prefix.Binary.Fixed})
+	case EncodingHex:
+		bitmap = field.NewBitmap(&field.Spec{Length: 8, Description: "Bitmap", Enc: encoding.BytesToASCIIHex, Pref: prefix.Hex.Fixed})
+	default:
+		return nil, fmt.Errorf("unknown bitmap encoding %q, expected binary or hex", encodings.Bitmap)
+	}
+
+	fields := map[int]field.Field{
+		0: field.NewString(&field.Spec{Length: 4, Description: "Message Type Indicator", Enc: numeric.enc, Pref: numeric.pref.Fixed}),
+		1: bitmap,
+	}
+	for n, def := range defs {
+		spec := &field.Spec{Length: def.length, Description: def.description}
+		switch {
+		case def.kind == kindBinary && encodings.Binary == EncodingBinary:
+			// Fixed binary fields keep the length of their hex text; variable
+			// ones keep their maximum length, in bytes.
+			spec.Enc = encoding.Binary
+			if def.prefix == fixed {
+				spec.Length = def.length / 2
+				spec.Pref = prefix.Binary.Fixed
+			} else {
+				spec.Pref = def.prefix.of(numeric.pref)
+			}
+			fields[n] = field.NewBinary(spec)
+			continue
+		case def.kind == kindNumeric:
+			// Numeric fields stay strings: field.NewNumeric holds an int64,
+			// which drops leading zeros (F3, F11) and can't hold F2 or F90.
+			spec.Enc = numeric.enc
+			spec.Pref = def.prefix.of(numeric.pref)
+		default:
+			spec.Enc = text.enc
+			spec.Pref = def.prefix.of(text.pref)
+		}
+		fields[n] = field.NewString(spec)
+	}
+	return &Spec{
+		Encodings: encodings,
+		defs:      defs,
+		messageSpec: &iso8583.MessageSpec{
+			Name:   fmt.Sprintf("ISO 8583:1987 %s numeric, %s text, %s bitmap, %s binary fields", encodings.Numeric, encodings.Text, encodings.Bitmap, encodings.Binary),
+			Fields: fields,
+		},
+	}, nil
+}
+
+func (spec *Spec) binary(n int) bool {
+	def, ok := spec.defs[n]
+	return ok && def.kind == kindBinary && spec.Encodings.Binary == EncodingBinary
+}
+
+// Parse unpacks a message without its length header.
+func (spec *Spec) Parse(data []byte) (*domain.ISO8583Message, error) {
+	message := iso8583.NewMessage(spec.messageSpec)
 
 	err := message.Unpack(data)
 	if err != nil {
@@ -34,81 +211,148 @@ func ParseISO8583(data []byte) (*domain.ISO8583Message, error) {
 	return domain.NewISO8583Message(mti, fields), nil
 }
 
-var napasSpec = &iso8583.MessageSpec{
-	Name: "ISO 8583:1987 ASCII fields + Binary Bitmap",
-	Fields: map[int]field.Field{
-		0: field.NewString(&field.Spec{
-			Length:      4,
-			Description: "Message Type Indicator",
-			Enc:         encoding.ASCII,
-			Pref:        prefix.ASCII.Fixed,
-		}),
-		1: field.NewBitmap(&field.Spec{
-			Length:      8,
-			Description: "Bitmap",
-			Enc:         encoding.Binary,
-			Pref:        prefix.Binary.Fixed,
-		}),
-
-		2:   field.NewString(&field.Spec{Length: 19, Description: "Primary Account Number", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		3:   field.NewString(&field.Spec{Length: 6, Description: "Processing Code", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		4:   field.NewString(&field.Spec{Length: 12, Description: "Amount, Transaction", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		5:   field.NewString(&field.Spec{Length: 12, Description: "Amount, Settlement", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		6:   field.NewString(&field.Spec{Length: 12, Description: "Amount, Cardholder Billing", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		7:   field.NewString(&field.Spec{Length: 10, Description: "Transmission Date & Time", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		9:   field.NewString(&field.Spec{Length: 8, Description: "Conversion Rate, Settlement", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		10:  field.NewString(&field.Spec{Length: 8, Description: "Conversion Rate, Cardholder Billing", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		11:  field.NewString(&field.Spec{Length: 6, Description: "System Trace Audit Number", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		12:  field.NewString(&field.Spec{Length: 6, Description: "Local Time", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		13:  field.NewString(&field.Spec{Length: 4, Description: "Local Date", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		14:  field.NewString(&field.Spec{Length: 4, Description: "Expiration Date", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		15:  field.NewString(&field.Spec{Length: 4, Description: "Settlement Date", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		18:  field.NewString(&field.Spec{Length: 4, Description: "Merchant Type", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		19:  field.NewString(&field.Spec{Length: 3, Description: "Acquiring Inst. Country Code", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		22:  field.NewString(&field.Spec{Length: 3, Description: "POS Entry Mode", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		23:  field.NewString(&field.Spec{Length: 3, Description: "Card Sequence Number", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		25:  field.NewString(&field.Spec{Length: 2, Description: "POS Condition Code", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		28:  field.NewString(&field.Spec{Length: 9, Description: "Amount, Fee", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}), // AMOUNT mapped as numeric 9
-		32:  field.NewString(&field.Spec{Length: 11, Description: "Acquiring Inst ID", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		33:  field.NewString(&field.Spec{Length: 11, Description: "Forwarding Inst ID", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		35:  field.NewString(&field.Spec{Length: 37, Description: "Track 2 Data", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		36:  field.NewString(&field.Spec{Length: 104, Description: "Track 3 Data", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		37:  field.NewString(&field.Spec{Length: 12, Description: "Retrieval Reference Number", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		38:  field.NewString(&field.Spec{Length: 6, Description: "Authorization ID", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		39:  field.NewString(&field.Spec{Length: 2, Description: "Response Code", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		41:  field.NewString(&field.Spec{Length: 8, Description: "Terminal ID", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		42:  field.NewString(&field.Spec{Length: 15, Description: "Merchant ID", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		43:  field.NewString(&field.Spec{Length: 40, Description: "Card Acceptor Name", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		45:  field.NewString(&field.Spec{Length: 76, Description: "Track 1 Data", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		48:  field.NewString(&field.Spec{Length: 999, Description: "Additional Data", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		49:  field.NewString(&field.Spec{Length: 3, Description: "Currency Code, Txn", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		50:  field.NewString(&field.Spec{Length: 3, Description: "Currency Code, Settlement", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		51:  field.NewString(&field.Spec{Length: 3, Description: "Currency Code, Cardholder", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		52:  field.NewString(&field.Spec{Length: 16, Description: "PIN Data", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		54:  field.NewString(&field.Spec{Length: 120, Description: "Additional Amounts", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		55:  field.NewString(&field.Spec{Length: 255, Description: "ICC Data", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		60:  field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		62:  field.NewString(&field.Spec{Length: 99, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		63:  field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		66:  field.NewString(&field.Spec{Length: 1, Description: "Settlement Code", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		67:  field.NewString(&field.Spec{Length: 2, Description: "Extended Payment Code", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		70:  field.NewString(&field.Spec{Length: 3, Description: "Network Mgmt Info Code", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		71:  field.NewString(&field.Spec{Length: 4, Description: "Message Number", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		72:  field.NewString(&field.Spec{Length: 4, Description: "Message Number Last", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		90:  field.NewString(&field.Spec{Length: 42, Description: "Original Data Elements", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		95:  field.NewString(&field.Spec{Length: 42, Description: "Replacement Amounts", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-		100: field.NewString(&field.Spec{Length: 11, Description: "Receiving Inst ID", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		102: field.NewString(&field.Spec{Length: 28, Description: "Account ID 1", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		103: field.NewString(&field.Spec{Length: 28, Description: "Account ID 2", Enc: encoding.ASCII, Pref: prefix.ASCII.LL}),
-		104: field.NewString(&field.Spec{Length: 255, Description: "Transaction Description", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		105: field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		110: field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		120: field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		121: field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		122: field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		123: field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		124: field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		125: field.NewString(&field.Spec{Length: 999, Description: "Reserved Private", Enc: encoding.ASCII, Pref: prefix.ASCII.LLL}),
-		128: field.NewString(&field.Spec{Length: 64, Description: "Message Authentication Code", Enc: encoding.ASCII, Pref: prefix.ASCII.Fixed}),
-	},
+// Pack packs a message without its length header. Fields 0 and 1 of parsed
+// messages are ignored: the MTI is msg.MTI and the bitmap is built from the
+// fields.
+func (spec *Spec) Pack(msg *domain.ISO8583Message) ([]byte, error) {
+	message := iso8583.NewMessage(spec.messageSpec)
+	message.MTI(msg.MTI)
+	for i, v := range msg.Fields {
+		if i < 2 {
+			continue
+		}
+		if spec.binary(i) {
+			b, err := hex.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("fail to decode binary field %d: %w", i, err)
+			}
+			if err := message.BinaryField(i, b); err != nil {
+				return nil, fmt.Errorf("fail to set field %d: %w", i, err)
+			}
+			continue
+		}
+		if err := message.Field(i, v); err != nil {
+			return nil, fmt.Errorf("fail to set field %d: %w", i, err)
+		}
+	}
+	data, err := message.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("fail to pack ISO8583 message: %w", err)
+	}
+	return data, nil
+}
+
+type fieldEncoding struct {
+	enc  encoding.Encoder
+	pref prefix.Prefixers
+}
+
+var numericEncodings = map[string]fieldEncoding{
+	EncodingASCII:  {encoding.ASCII, prefix.ASCII},
+	EncodingBCD:    {encoding.BCD, prefix.BCD},
+	EncodingEBCDIC: {encoding.EBCDIC1047, prefix.EBCDIC1047},
+}
+
+var textEncodings = map[string]fieldEncoding{
+	EncodingASCII:  {encoding.ASCII, prefix.ASCII},
+	EncodingEBCDIC: {encoding.EBCDIC1047, prefix.EBCDIC1047},
+}
+
+type fieldKind int
+
+const (
+	kindNumeric fieldKind = iota
+	kindText
+	kindBinary
+)
+
+type prefixKind int
+
+const (
+	fixed prefixKind = iota
+	ll
+	lll
+)
+
+func (p prefixKind) of(prefixers prefix.Prefixers) prefix.Prefixer {
+	switch p {
+	case ll:
+		return prefixers.LL
+	case lll:
+		return prefixers.LLL
+	default:
+		return prefixers.Fixed
+	}
+}
+
+type fieldDef struct {
+	kind        fieldKind
+	length      int
+	prefix      prefixKind
+	description string
+}
+
+// fieldDefs are the NAPAS data elements. Lengths are in characters, or in
+// hex characters for binary fields.
+var fieldDefs = map[int]fieldDef{
+	2:   {kindNumeric, 19, ll, "Primary Account Number"},
+	3:   {kindNumeric, 6, fixed, "Processing Code"},
+	4:   {kindNumeric, 12, fixed, "Amount, Transaction"},
+	5:   {kindNumeric, 12, fixed, "Amount, Settlement"},
+	6:   {kindNumeric, 12, fixed, "Amount, Cardholder Billing"},
+	7:   {kindNumeric, 10, fixed, "Transmission Date & Time"},
+	9:   {kindNumeric, 8, fixed, "Conversion Rate, Settlement"},
+	10:  {kindNumeric, 8, fixed, "Conversion Rate, Cardholder Billing"},
+	11:  {kindNumeric, 6, fixed, "System Trace Audit Number"},
+	12:  {kindNumeric, 6, fixed, "Local Time"},
+	13:  {kindNumeric, 4, fixed, "Local Date"},
+	14:  {kindNumeric, 4, fixed, "Expiration Date"},
+	15:  {kindNumeric, 4, fixed, "Settlement Date"},
+	18:  {kindNumeric, 4, fixed, "Merchant Type"},
+	19:  {kindNumeric, 3, fixed, "Acquiring Inst. Country Code"},
+	22:  {kindNumeric, 3, fixed, "POS Entry Mode"},
+	23:  {kindNumeric, 3, fixed, "Card Sequence Number"},
+	25:  {kindNumeric, 2, fixed, "POS Condition Code"},
+	28:  {kindText, 9, fixed, "Amount, Fee"}, // AMOUNT mapped as numeric 9
+	32:  {kindNumeric, 11, ll, "Acquiring Inst ID"},
+	33:  {kindNumeric, 11, ll, "Forwarding Inst ID"},
+	35:  {kindText, 37, ll, "Track 2 Data"},
+	36:  {kindText, 104, lll, "Track 3 Data"},
+	37:  {kindText, 12, fixed, "Retrieval Reference Number"},
+	38:  {kindText, 6, fixed, "Authorization ID"},
+	39:  {kindText, 2, fixed, "Response Code"},
+	41:  {kindText, 8, fixed, "Terminal ID"},
+	42:  {kindText, 15, fixed, "Merchant ID"},
+	43:  {kindText, 40, fixed, "Card Acceptor Name"},
+	45:  {kindText, 76, ll, "Track 1 Data"},
+	48:  {kindText, 999, lll, "Additional Data"},
+	49:  {kindNumeric, 3, fixed, "Currency Code, Txn"},
+	50:  {kindNumeric, 3, fixed, "Currency Code, Settlement"},
+	51:  {kindNumeric, 3, fixed, "Currency Code, Cardholder"},
+	52:  {kindBinary, 16, fixed, "PIN Data"},
+	54:  {kindText, 120, lll, "Additional Amounts"},
+	55:  {kindBinary, 255, lll, "ICC Data"},
+	60:  {kindText, 999, lll, "Reserved Private"},
+	62:  {kindText, 99, ll, "Reserved Private"},
+	63:  {kindText, 999, lll, "Reserved Private"},
+	66:  {kindNumeric, 1, fixed, "Settlement Code"},
+	67:  {kindNumeric, 2, fixed, "Extended Payment Code"},
+	70:  {kindNumeric, 3, fixed, "Network Mgmt Info Code"},
+	71:  {kindNumeric, 4, fixed, "Message Number"},
+	72:  {kindNumeric, 4, fixed, "Message Number Last"},
+	90:  {kindNumeric, 42, fixed, "Original Data Elements"},
+	95:  {kindText, 42, fixed, "Replacement Amounts"},
+	100: {kindNumeric, 11, ll, "Receiving Inst ID"},
+	102: {kindText, 28, ll, "Account ID 1"},
+	103: {kindText, 28, ll, "Account ID 2"},
+	104: {kindText, 255, lll, "Transaction Description"},
+	105: {kindText, 999, lll, "Reserved Private"},
+	110: {kindText, 999, lll, "Reserved Private"},
+	120: {kindText, 999, lll, "Reserved Private"},
+	121: {kindText, 999, lll, "Reserved Private"},
+	122: {kindText, 999, lll, "Reserved Private"},
+	123: {kindText, 999, lll, "Reserved Private"},
+	124: {kindText, 999, lll, "Reserved Private"},
+	125: {kindText, 999, lll, "Reserved Private"},
+	128: {kindBinary, 64, fixed, "Message Authentication Code"},
 }
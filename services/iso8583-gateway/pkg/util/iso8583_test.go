@@ -0,0 +1,152 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"iso8583-gateway/internal/domain"
+	"maps"
+	"testing"
+)
+
+func sampleMessage() *domain.ISO8583Message {
+	return domain.NewISO8583Message("0200", map[int]string{
+		2:   "9704366614952079",
+		3:   "912000",
+		4:   "000001500000",
+		7:   "1019093015",
+		11:  "000123",
+		32:  "970436",
+		37:  "629209123456",
+		41:  "ATM00001",
+		43:  "GATEWAY TEST                    HANOI VN",
+		49:  "704",
+		52:  "0123456789ABCDEF",
+		55:  "9F2608C2A1B3D4E5F60718",
+		63:  "5f0c2f9e-3b7d-4c1a-9d0e-2a6b8c4d1e3f",
+		100: "970400",
+		103: "0123456789",
+		128: "00112233445566778899AABBCCDDEEFF00112233445566778899AABBCCDDEEFF",
+	})
+}
+
+// allEncodings returns every combination of encodings a profile may use.
+func allEncodings() []Encodings {
+	var all []Encodings
+	for _, numeric := range []string{EncodingASCII, EncodingBCD, EncodingEBCDIC} {
+		for _, text := range []string{EncodingASCII, EncodingEBCDIC} {
+			for _, bitmap := range []string{EncodingBinary, EncodingHex} {
+				for _, binary := range []string{EncodingASCII, EncodingBinary} {
+					all = append(all, Encodings{Numeric: numeric, Text: text, Bitmap: bitmap, Binary: binary})
+				}
+			}
+		}
+	}
+	return all
+}
+
+func encodingsName(e Encodings) string {
+	return fmt.Sprintf("numeric=%s,text=%s,bitmap=%s,binary=%s", e.Numeric, e.Text, e.Bitmap, e.Binary)
+}
+
+// TestRoundTrip packs the sample message in every combination of encodings
+// and checks that it parses back the same, and that the parsed message packs
+// to the same bytes, as responses are packed from parsed requests.
+func TestRoundTrip(t *testing.T) {
+	for _, encodings := range allEncodings() {
+		t.Run(encodingsName(encodings), func(t *testing.T) {
+			spec, err := NewSpec(encodings, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertRoundTrip(t, spec, sampleMessage())
+		})
+	}
+}
+
+func assertRoundTrip(t *testing.T, spec *Spec, msg *domain.ISO8583Message) {
+	t.Helper()
+	data, err := spec.Pack(msg)
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	parsed, err := spec.Parse(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// Parsed messages also hold the MTI and the bitmap as fields 0 and 1.
+	fields := maps.Clone(parsed.Fields)
+	delete(fields, 0)
+	delete(fields, 1)
+	if parsed.MTI != msg.MTI || !maps.Equal(fields, msg.Fields) {
+		t.Fatalf("got %s %v, want %s %v", parsed.MTI, fields, msg.MTI, msg.Fields)
+	}
+	repacked, err := spec.Pack(parsed)
+	if err != nil {
+		t.Fatalf("pack parsed: %v", err)
+	}
+	if !bytes.Equal(repacked, data) {
+		t.Fatalf("parsed message packs to % X, want % X", repacked, data)
+	}
+}
+
+// TestEncodedBytes checks the bytes of the MTI and the start of the bitmap
+// against the encodings, which a round trip alone can't tell apart.
+func TestEncodedBytes(t *testing.T) {
+	for _, tt := range []struct {
+		encodings Encodings
+		prefix    []byte
+	}{
+		{Encodings{Numeric: EncodingASCII, Bitmap: EncodingBinary}, []byte{'0', '2', '0', '0', 0xF2}},
+		{Encodings{Numeric: EncodingBCD, Bitmap: EncodingBinary}, []byte{0x02, 0x00, 0xF2}},
+		{Encodings{Numeric: EncodingEBCDIC, Bitmap: EncodingBinary}, []byte{0xF0, 0xF2, 0xF0, 0xF0, 0xF2}},
+		{Encodings{Numeric: EncodingASCII, Bitmap: EncodingHex}, []byte("0200F2")},
+	} {
+		spec, err := NewSpec(tt.encodings, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := spec.Pack(sampleMessage())
+		if err != nil {
+			t.Fatalf("%s: %v", encodingsName(tt.encodings), err)
+		}
+		if !bytes.HasPrefix(data, tt.prefix) {
+			t.Errorf("%s: packed % X, want prefix % X", encodingsName(tt.encodings), data[:min(len(data), 8)], tt.prefix)
+		}
+	}
+}
+
+// TestPackResponseMTI answers a parsed request the way the gateway does, by
+// copying its fields under the response MTI. Parsed fields 0 and 1 must not
+// override the MTI.
+func TestPackResponseMTI(t *testing.T) {
+	for _, encodings := range allEncodings() {
+		spec, err := NewSpec(encodings, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := spec.Pack(sampleMessage())
+		if err != nil {
+			t.Fatalf("%+v: pack request: %v", encodings, err)
+		}
+		request, err := spec.Parse(data)
+		if err != nil {
+			t.Fatalf("%+v: parse request: %v", encodings, err)
+		}
+		if _, ok := request.Fields[0]; !ok {
+			t.Fatalf("%+v: parsed request has no field 0", encodings)
+		}
+		fields := maps.Clone(request.Fields)
+		fields[39] = "68"
+		data, err = spec.Pack(domain.NewISO8583Message(domain.ResponseMTI(request.MTI), fields))
+		if err != nil {
+			t.Fatalf("%+v: pack response: %v", encodings, err)
+		}
+		response, err := spec.Parse(data)
+		if err != nil {
+			t.Fatalf("%+v: parse response: %v", encodings, err)
+		}
+		if response.MTI != "0210" || response.Fields[39] != "68" {
+			t.Errorf("%+v: got %s F39 %q, want 0210 F39 \"68\"", encodings, response.MTI, response.Fields[39])
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// sensitiveFields are removed entirely: track data, PIN block, ICC data and expiry date.
+var sensitiveFields = map[int]bool{14: true, 35: true, 36: true, 45: true, 52: true, 55: true}
+
+// accountFields keep only their last four characters.
+var accountFields = map[int]bool{102: true, 103: true}
+
+// RedactFields returns a copy of fields safe to store or show: the PAN keeps
+// its first six and last four digits, account numbers their last four, and
+// cardholder secrets are masked completely.
+func RedactFields(fields map[int]string) map[int]string {
+	redacted := make(map[int]string, len(fields))
+	for i, v := range fields {
+		switch {
+		case i == 2:
+			redacted[i] = maskMiddle(v, 6, 4)
+		case accountFields[i]:
+			redacted[i] = maskMiddle(v, 0, 4)
+		case sensitiveFields[i]:
+			redacted[i] = strings.Repeat("*", len(v))
+		default:
+			redacted[i] = v
+		}
+	}
+	return redacted
+}
+
+// HashValue returns the hex HMAC-SHA256 of a value under key, used to search
+// by account number without storing it. Account numbers are too few for a
+// plain hash not to be reversed by brute force, so without a key there is no
+// hash.
+func HashValue(key []byte, value string) string {
+	if len(key) == 0 || value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func maskMiddle(value string, head int, tail int) string {
+	if len(value) <= head+tail {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:head] + strings.Repeat("*", len(value)-head-tail) + value[len(value)-tail:]
+}
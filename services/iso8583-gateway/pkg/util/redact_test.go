@@ -0,0 +1,26 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestHashValue(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	account := "0123456789"
+	hash := HashValue(key, account)
+	if hash == "" || hash != HashValue(key, account) {
+		t.Fatalf("HashValue is not deterministic: %q", hash)
+	}
+	plain := sha256.Sum256([]byte(account))
+	if hash == hex.EncodeToString(plain[:]) {
+		t.Error("HashValue is the unkeyed SHA-256")
+	}
+	if HashValue([]byte("fedcba9876543210fedcba9876543210"), account) == hash {
+		t.Error("HashValue does not depend on the key")
+	}
+	if HashValue(nil, account) != "" || HashValue(key, "") != "" {
+		t.Error("HashValue without a key or a value must be empty")
+	}
+}
@@ -28,6 +28,7 @@ public class InboundRequestConsumer {
         log.info("Received message: {}", jsonMessage);
         Optional<ISO8583Message> optional = ObjectMapperUtil.fromJson(jsonMessage, ISO8583Message.class);
         if (optional.isEmpty()) {
+            log.warn("Skipping unreadable message, trace_id: {}", traceId);
             return;
         }
         ISO8583Message message = optional.get();
@@ -1,10 +1,17 @@
 package com.example.transferservice.dto;
 
+import com.fasterxml.jackson.annotation.JsonIgnoreProperties;
 import lombok.Data;
 
 import java.util.Map;
 
+/**
+ * The mti and fields of a request published by the iso8583-gateway. The gateway
+ * wraps them in an envelope with more keys (trace_id, received_at, institution,
+ * ...), which are ignored here.
+ */
 @Data
+@JsonIgnoreProperties(ignoreUnknown = true)
 public class ISO8583Message {
     private String mti;
     private Map<Integer, String> fields;
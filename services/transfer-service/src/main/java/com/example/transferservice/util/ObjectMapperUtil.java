@@ -1,5 +1,6 @@
 package com.example.transferservice.util;
 
+import com.fasterxml.jackson.databind.DeserializationFeature;
 import com.fasterxml.jackson.databind.ObjectMapper;
 import lombok.experimental.UtilityClass;
 import lombok.extern.slf4j.Slf4j;
@@ -9,7 +10,9 @@ import java.util.Optional;
 @UtilityClass
 @Slf4j
 public class ObjectMapperUtil {
-    private final ObjectMapper mapper = new ObjectMapper();
+    // Producers add keys over time; a message is read as long as the keys we use are there.
+    private final ObjectMapper mapper = new ObjectMapper()
+            .configure(DeserializationFeature.FAIL_ON_UNKNOWN_PROPERTIES, false);
 
     public Optional<String> toJson(Object obj) {
         try {
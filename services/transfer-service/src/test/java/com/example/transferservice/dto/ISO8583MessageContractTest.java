@@ -0,0 +1,47 @@
+package com.example.transferservice.dto;
+
+import com.example.transferservice.util.ObjectMapperUtil;
+import org.junit.jupiter.api.Test;
+
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.util.Optional;
+
+import static org.assertj.core.api.Assertions.assertThat;
+
+/**
+ * Reads the envelope the iso8583-gateway publishes. The fixture is kept in step
+ * with the gateway by its TestEnvelopeMatchesFixture, so a gateway change that
+ * this DTO can't read fails here.
+ */
+class ISO8583MessageContractTest {
+    private static final Path ENVELOPE = Path.of("..", "iso8583-gateway", "pkg", "contract", "testdata", "envelope.json");
+
+    @Test
+    void readsGatewayEnvelope() throws Exception {
+        Optional<ISO8583Message> message = ObjectMapperUtil.fromJson(Files.readString(ENVELOPE), ISO8583Message.class);
+
+        assertThat(message).isPresent();
+        assertThat(message.get().getMti()).isEqualTo("0200");
+        assertThat(message.get().getFields())
+                .containsEntry(2, "9704361234567890")
+                .containsEntry(4, "000000150000")
+                .containsEntry(63, "trace-1");
+    }
+
+    @Test
+    void readsBareMessage() {
+        Optional<ISO8583Message> message = ObjectMapperUtil.fromJson("{\"mti\":\"0200\",\"fields\":{\"11\":\"000123\"}}", ISO8583Message.class);
+
+        assertThat(message).isPresent();
+        assertThat(message.get().getFields()).containsEntry(11, "000123");
+    }
+
+    @Test
+    void ignoresKeysAddedLater() {
+        Optional<ISO8583Message> message = ObjectMapperUtil.fromJson("{\"schema_version\":2,\"mti\":\"0800\",\"fields\":{\"70\":\"301\"},\"new_key\":{\"a\":1}}", ISO8583Message.class);
+
+        assertThat(message).isPresent();
+        assertThat(message.get().getMti()).isEqualTo("0800");
+    }
+}